@@ -0,0 +1,125 @@
+package freeproxy
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/xwjdsh/freeproxy/config"
+	"github.com/xwjdsh/freeproxy/storage"
+)
+
+// backoffHistoryRuns is the number of latest runs of every source to compute the state.
+const backoffHistoryRuns = 64
+
+type SourceState struct {
+	Name string
+	// Failures is the number of consecutive failed runs
+	Failures  int
+	LastRunAt time.Time
+	// Until is the time before which the source is skipped, zero if the source is active
+	Until time.Time
+}
+
+func (s *SourceState) Skipped(now time.Time) bool {
+	return now.Before(s.Until)
+}
+
+// sourceFailed reports whether the source errored or yielded no valid proxies in the run,
+// the proxies of the unsupported types are a yield as they can not be validated.
+func sourceFailed(s *storage.Source) bool {
+	return s.Error != "" || (!s.NotModified && s.Created+s.Duplicated+s.Unsupported == 0)
+}
+
+// SourceStates returns the backoff states of the sources which have been fetched.
+func (h *Handler) SourceStates(ctx context.Context) (map[string]*SourceState, error) {
+	return getSourceStates(ctx, h.storage, h.cfg.Fetch.Backoff, h.backoffExempt)
+}
+
+// SourceStates returns the backoff states like Handler.SourceStates, but the storage is opened read-only,
+// so it is not created, migrated or pruned, there are no states if the storage does not exist.
+func SourceStates(ctx context.Context, cfg *config.Config) (map[string]*SourceState, error) {
+	if b := cfg.App.Fetch.Backoff; b == nil || !b.Enable {
+		return map[string]*SourceState{}, nil
+	}
+
+	s, err := storage.Open(cfg.Storage)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]*SourceState{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+
+	return getSourceStates(ctx, s, cfg.App.Fetch.Backoff, backoffExempt(cfg.Parser))
+}
+
+func getSourceStates(ctx context.Context, s *storage.Handler, cfg *config.AppFetchBackoffConfig, exempt map[string]bool) (map[string]*SourceState, error) {
+	if cfg == nil || !cfg.Enable {
+		return map[string]*SourceState{}, nil
+	}
+
+	ss, err := s.GetSources(ctx, &storage.SourceQueryOptions{Runs: backoffHistoryRuns})
+	if err != nil {
+		return nil, err
+	}
+	return sourceStates(ss, cfg, exempt), nil
+}
+
+// backoffExempt returns the local sources, which are never backed off.
+func backoffExempt(cfg *config.ParserConfig) map[string]bool {
+	exempt := map[string]bool{}
+	for _, e := range cfg.Executors {
+		if e.Local() {
+			exempt[e.Name] = true
+		}
+	}
+	return exempt
+}
+
+// sourceStates computes the states from the runs ordered by the latest first,
+// the exempt sources are never skipped.
+func sourceStates(ss []*storage.Source, cfg *config.AppFetchBackoffConfig, exempt map[string]bool) map[string]*SourceState {
+	states := map[string]*SourceState{}
+	done := map[string]bool{}
+	for _, s := range ss {
+		state := states[s.Name]
+		if state == nil {
+			// the latest run comes first
+			state = &SourceState{Name: s.Name, LastRunAt: s.CreatedAt}
+			states[s.Name] = state
+		}
+		if done[s.Name] {
+			continue
+		}
+		// the content has not changed, it says nothing about the health
+		if s.NotModified && s.Error == "" {
+			continue
+		}
+		if !sourceFailed(s) {
+			done[s.Name] = true
+			continue
+		}
+		state.Failures += 1
+	}
+
+	for _, state := range states {
+		if exempt[state.Name] {
+			continue
+		}
+		if n := state.Failures - cfg.Threshold; n >= 0 {
+			interval := cfg.BaseInterval
+			for i := 0; i < n && interval < cfg.MaxInterval; i++ {
+				interval *= 2
+			}
+			if interval > cfg.MaxInterval {
+				interval = cfg.MaxInterval
+			}
+			state.Until = state.LastRunAt.Add(interval)
+		}
+	}
+
+	return states
+}
@@ -0,0 +1,116 @@
+package freeproxy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xwjdsh/freeproxy/config"
+	"github.com/xwjdsh/freeproxy/storage"
+)
+
+func TestSourceFailed(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		source *storage.Source
+		failed bool
+	}{
+		{"error", &storage.Source{Error: "timeout", Created: 1}, true},
+		{"empty", &storage.Source{Seen: 10}, true},
+		{"created", &storage.Source{Created: 1}, false},
+		{"duplicated", &storage.Source{Duplicated: 1}, false},
+		{"unsupported", &storage.Source{Seen: 2, Unsupported: 2}, false},
+		{"not modified", &storage.Source{NotModified: true}, false},
+		{"not modified with error", &storage.Source{NotModified: true, Error: "saving cache"}, true},
+	} {
+		assert.Equal(t, c.failed, sourceFailed(c.source), c.name)
+	}
+}
+
+func TestSourceStates(t *testing.T) {
+	now := time.Now()
+	cfg := &config.AppFetchBackoffConfig{Enable: true, Threshold: 2, BaseInterval: time.Hour, MaxInterval: 3 * time.Hour}
+	run := func(name string, ago time.Duration, s storage.Source) *storage.Source {
+		s.Name, s.CreatedAt = name, now.Add(-ago)
+		return &s
+	}
+	failed := storage.Source{Error: "timeout"}
+	ok := storage.Source{Created: 1}
+
+	// the latest run comes first
+	states := sourceStates([]*storage.Source{
+		run("recovered", 0, ok),
+		run("once", 0, failed),
+		run("twice", 0, failed),
+		run("capped", 0, failed),
+		run("stdin", 0, failed),
+		run("recovered", time.Hour, failed),
+		run("recovered", 2*time.Hour, failed),
+		run("once", time.Hour, ok),
+		run("twice", time.Hour, storage.Source{NotModified: true}),
+		run("twice", 2*time.Hour, failed),
+		run("capped", time.Hour, failed),
+		run("capped", 2*time.Hour, failed),
+		run("capped", 3*time.Hour, failed),
+		run("capped", 4*time.Hour, failed),
+		run("stdin", time.Hour, failed),
+		run("stdin", 2*time.Hour, failed),
+	}, cfg, map[string]bool{"stdin": true})
+
+	require.Len(t, states, 5)
+	for _, c := range []struct {
+		name     string
+		failures int
+		until    time.Time
+	}{
+		{"recovered", 0, time.Time{}},
+		{"once", 1, time.Time{}},
+		// the not modified run is ignored
+		{"twice", 2, now.Add(time.Hour)},
+		// 1h doubled three times, capped by MaxInterval
+		{"capped", 5, now.Add(3 * time.Hour)},
+		// the exempt source is never skipped
+		{"stdin", 3, time.Time{}},
+	} {
+		s := states[c.name]
+		require.NotNil(t, s, c.name)
+		assert.Equal(t, c.failures, s.Failures, c.name)
+		assert.Equal(t, now, s.LastRunAt, c.name)
+		assert.True(t, c.until.Equal(s.Until), c.name)
+		assert.Equal(t, !c.until.IsZero(), s.Skipped(now), c.name)
+		assert.False(t, s.Skipped(now.Add(4*time.Hour)), c.name)
+	}
+}
+
+func TestSourceStatesReadOnly(t *testing.T) {
+	ctx := context.Background()
+	cfg := config.DefaultConfig()
+	cfg.Storage.DSN = filepath.Join(t.TempDir(), "db")
+	cfg.App.Fetch.Backoff.Threshold = 1
+	cfg.Parser.Executors = []*config.ParserExecutor{{Name: "stdin", Enable: true, FilePath: "-"}}
+
+	// the missing storage is not created
+	states, err := SourceStates(ctx, cfg)
+	require.Nil(t, err)
+	assert.Empty(t, states)
+	_, err = os.Stat(cfg.Storage.DSN)
+	assert.True(t, os.IsNotExist(err))
+
+	s, err := storage.Init(cfg.Storage)
+	require.Nil(t, err)
+	for _, name := range []string{"remote", "stdin"} {
+		require.Nil(t, s.CreateSource(ctx, &storage.Source{Name: name, Error: "timeout"}))
+	}
+	require.Nil(t, s.Close())
+
+	states, err = SourceStates(ctx, cfg)
+	require.Nil(t, err)
+	require.Len(t, states, 2)
+	assert.True(t, states["remote"].Skipped(time.Now()))
+	assert.False(t, states["stdin"].Skipped(time.Now()))
+}
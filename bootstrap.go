@@ -0,0 +1,88 @@
+package freeproxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/xwjdsh/freeproxy/log"
+	"github.com/xwjdsh/freeproxy/storage"
+	"github.com/xwjdsh/freeproxy/validator"
+)
+
+type bootstrapProxy struct {
+	address string
+	dial    func(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// bootstrapDialer dials through the stored proxies, it falls back to the next one on failure.
+type bootstrapDialer struct {
+	proxies []*bootstrapProxy
+	mutex   sync.Mutex
+	current int
+}
+
+func (d *bootstrapDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	d.mutex.Lock()
+	start := d.current
+	d.mutex.Unlock()
+
+	var lastErr error
+	for i := 0; i < len(d.proxies); i++ {
+		index := (start + i) % len(d.proxies)
+		p := d.proxies[index]
+		conn, err := p.dial(ctx, network, address)
+		if err == nil {
+			d.mutex.Lock()
+			d.current = index
+			d.mutex.Unlock()
+			return conn, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		log.L().Debug("freeproxy: bootstrap proxy dial error", zap.String("proxy", p.address), zap.String("address", address), zap.Error(err))
+		lastErr = err
+	}
+
+	return nil, fmt.Errorf("freeproxy: all bootstrap proxies failed: %w", lastErr)
+}
+
+// bootstrap routes the parser HTTP traffic through the fastest stored proxies.
+func (h *Handler) bootstrap(ctx context.Context) error {
+	ps, err := h.storage.GetProxies(ctx, &storage.QueryOptions{
+		Fast:  true,
+		Count: h.cfg.Fetch.BootstrapCount,
+		Types: validator.SupportedTypes,
+	})
+	if err != nil {
+		return err
+	}
+
+	d := &bootstrapDialer{}
+	for _, p := range ps {
+		pp, err := p.Restore(p.Config)
+		if err != nil {
+			continue
+		}
+		dial, err := h.validator.Dialer(pp)
+		if err != nil {
+			continue
+		}
+		d.proxies = append(d.proxies, &bootstrapProxy{
+			address: net.JoinHostPort(p.Server, strconv.Itoa(p.Port)),
+			dial:    dial,
+		})
+	}
+	if len(d.proxies) == 0 {
+		return fmt.Errorf("freeproxy: no stored proxies available for bootstrap")
+	}
+
+	h.parser.SetDialer(d.DialContext)
+	return nil
+}
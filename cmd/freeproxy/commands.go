@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/urfave/cli/v2"
 
@@ -37,6 +38,31 @@ var (
 				return err
 			}
 			fmt.Printf(string(data))
+			if c.Bool("default") {
+				return nil
+			}
+
+			states, err := freeproxy.SourceStates(c.Context, cfg)
+			if err != nil {
+				return err
+			}
+			fmt.Println("\n# source states:")
+			now := time.Now()
+			for _, e := range cfg.Parser.Executors {
+				if !e.Enable {
+					fmt.Printf("# %s: disabled\n", e.Name)
+					continue
+				}
+				s := states[e.Name]
+				switch {
+				case s == nil:
+					fmt.Printf("# %s: active, never fetched\n", e.Name)
+				case s.Skipped(now):
+					fmt.Printf("# %s: backoff until %s, failures: %d\n", e.Name, s.Until.Format("2006-01-02 15:04"), s.Failures)
+				default:
+					fmt.Printf("# %s: active, failures: %d\n", e.Name, s.Failures)
+				}
+			}
 			return nil
 		},
 	}
@@ -56,6 +82,18 @@ var (
 				Aliases: []string{"w"},
 				Usage:   "Worker count",
 			},
+			&cli.BoolFlag{
+				Name:  "stdin",
+				Usage: "Read links from stdin instead of the configured sources",
+			},
+			&cli.BoolFlag{
+				Name:  "force",
+				Usage: "Fetch all sources even if they are not modified or backed off",
+			},
+			&cli.BoolFlag{
+				Name:  "bootstrap",
+				Usage: "Fetch sources through the fastest stored proxies",
+			},
 		},
 		Action: func(c *cli.Context) error {
 			h, err := getHandler(c, func(cfg *config.Config) {
@@ -63,6 +101,20 @@ var (
 				if v := c.Int("worker"); v != 0 {
 					cc.Worker = v
 				}
+				if c.Bool("bootstrap") {
+					cc.Bootstrap = true
+				}
+				if c.Bool("force") {
+					cfg.Parser.Force = true
+					if cc.Backoff != nil {
+						cc.Backoff.Enable = false
+					}
+				}
+				if c.Bool("stdin") {
+					cfg.Parser.Executors = []*config.ParserExecutor{
+						{Name: "stdin", Enable: true, FilePath: "-", Timeout: time.Hour},
+					}
+				}
 			})
 			if err != nil {
 				return err
@@ -81,11 +133,15 @@ var (
 				Aliases: []string{"q"},
 				Usage:   "Quiet mode, do not display progress bar",
 			},
-			&cli.BoolFlag{
+			&cli.IntFlag{
 				Name:    "worker",
 				Aliases: []string{"w"},
 				Usage:   "Worker count",
 			},
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "List the proxies which would be removed without changing anything",
+			},
 		},
 		Action: func(c *cli.Context) error {
 			h, err := getHandler(c, func(cfg *config.Config) {
@@ -97,7 +153,7 @@ var (
 			if err != nil {
 				return err
 			}
-			return h.Tidy(c.Context, c.Bool("quiet"))
+			return h.Tidy(c.Context, c.Bool("quiet"), c.Bool("dry-run"))
 		},
 	}
 
@@ -126,6 +182,34 @@ var (
 		},
 	}
 
+	sourcesCommand = &cli.Command{
+		Name:  "sources",
+		Usage: "Display fetch statistics of sources",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "name",
+				Aliases: []string{"n"},
+				Usage:   "Display every run of the source",
+			},
+			&cli.IntFlag{
+				Name:    "runs",
+				Aliases: []string{"r"},
+				Usage:   "Number of latest runs of every source",
+				Value:   10,
+			},
+		},
+		Action: func(c *cli.Context) error {
+			h, err := getHandler(c, nil)
+			if err != nil {
+				return err
+			}
+			return h.Sources(c.Context, &freeproxy.SourcesOptions{
+				Name: c.String("name"),
+				Runs: c.Int("runs"),
+			})
+		},
+	}
+
 	exportCommand = &cli.Command{
 		Name:    "export",
 		Aliases: []string{"e"},
@@ -151,6 +235,18 @@ var (
 				Aliases: []string{"ncc"},
 				Usage:   "Filter proxies other than country codes, for example 'CN,IN'",
 			},
+			&cli.BoolFlag{
+				Name:  "exit",
+				Usage: "Filter country codes by the exit countries of proxies",
+			},
+			&cli.StringFlag{
+				Name:  "profile",
+				Usage: "Filter proxies which pass the validation profile",
+			},
+			&cli.UintFlag{
+				Name:  "min-speed",
+				Usage: "Filter proxies by the download speed in kbps",
+			},
 			&cli.UintFlag{
 				Name:  "id",
 				Usage: "Filter proxies by id",
@@ -160,6 +256,10 @@ var (
 				Aliases: []string{"c"},
 				Usage:   "Get the top N fastest proxies",
 			},
+			&cli.StringFlag{
+				Name:  "sort",
+				Usage: "Sort proxies by 'delay', 'reliability' or 'speed'",
+			},
 		},
 		Action: func(c *cli.Context) error {
 			h, err := getHandler(c, func(cfg *config.Config) {
@@ -176,12 +276,24 @@ var (
 				if v := c.String("not-country-code"); v != "" {
 					cc.ProxyNotCountryCodes = v
 				}
+				if c.Bool("exit") {
+					cc.ExitCountry = true
+				}
+				if v := c.String("profile"); v != "" {
+					cc.Profile = v
+				}
+				if v := c.Uint("min-speed"); v != 0 {
+					cc.MinSpeed = v
+				}
 				if v := c.Uint("id"); v != 0 {
 					cc.ProxyID = v
 				}
 				if v := c.Int("count"); v != 0 {
 					cc.ProxyCount = v
 				}
+				if v := c.String("sort"); v != "" {
+					cc.Sort = v
+				}
 			})
 			if err != nil {
 				return err
@@ -220,6 +332,18 @@ var (
 				Aliases: []string{"ncc"},
 				Usage:   "Filter proxies other than country codes, for example 'CN,IN'",
 			},
+			&cli.BoolFlag{
+				Name:  "exit",
+				Usage: "Filter country codes by the exit countries of proxies",
+			},
+			&cli.StringFlag{
+				Name:  "profile",
+				Usage: "Filter proxies which pass the validation profile",
+			},
+			&cli.UintFlag{
+				Name:  "min-speed",
+				Usage: "Filter proxies by the download speed in kbps",
+			},
 			&cli.BoolFlag{
 				Name:    "fast",
 				Aliases: []string{"f"},
@@ -230,6 +354,10 @@ var (
 				Aliases: []string{"s"},
 				Usage:   "Switch proxy server",
 			},
+			&cli.StringFlag{
+				Name:  "sort",
+				Usage: "Pick the proxy by 'delay', 'reliability' or 'speed'",
+			},
 			&cli.UintFlag{
 				Name:  "id",
 				Usage: "Filter proxies by id",
@@ -253,6 +381,18 @@ var (
 				if v := c.String("not-country-code"); v != "" {
 					cc.ProxyNotCountryCodes = v
 				}
+				if c.Bool("exit") {
+					cc.ExitCountry = true
+				}
+				if v := c.String("profile"); v != "" {
+					cc.Profile = v
+				}
+				if v := c.Uint("min-speed"); v != 0 {
+					cc.MinSpeed = v
+				}
+				if v := c.String("sort"); v != "" {
+					cc.Sort = v
+				}
 			})
 			if err != nil {
 				return err
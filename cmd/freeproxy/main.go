@@ -25,6 +25,7 @@ func main() {
 			fetchCommand,
 			tidyCommand,
 			summaryCommand,
+			sourcesCommand,
 			exportCommand,
 			proxyCommand,
 		},
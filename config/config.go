@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strings"
 	"time"
 
 	"go.uber.org/zap/zapcore"
@@ -32,10 +33,49 @@ type AppConfig struct {
 
 type AppFetchConfig struct {
 	Worker int `yaml:"worker"`
+	// Bootstrap routes the parser requests through the fastest stored proxies
+	Bootstrap bool `yaml:"bootstrap"`
+	// BootstrapCount is the number of stored proxies to fall back through
+	BootstrapCount int `yaml:"bootstrap_count"`
+	// Backoff skips the sources which keep failing
+	Backoff *AppFetchBackoffConfig `yaml:"backoff"`
+}
+
+type AppFetchBackoffConfig struct {
+	Enable bool `yaml:"enable"`
+	// Threshold is the number of consecutive failed runs before a source is skipped,
+	// a run is failed if the source errors or yields no valid proxies
+	Threshold int `yaml:"threshold"`
+	// BaseInterval is the first skip interval, it doubles with every further failed run
+	BaseInterval time.Duration `yaml:"base_interval"`
+	MaxInterval  time.Duration `yaml:"max_interval"`
 }
 
 type AppTidyConfig struct {
 	Worker int `yaml:"worker"`
+	// a failed proxy is marked as unhealthy, and removed if any of the thresholds is reached,
+	// a zero threshold is disabled
+	MaxConsecutiveFailures int `yaml:"max_consecutive_failures"`
+	// MaxFailureRatio is checked when there are FailureWindow checks at least
+	MaxFailureRatio float64 `yaml:"max_failure_ratio"`
+	FailureWindow   int     `yaml:"failure_window"`
+	// MaxSuccessAge is the max duration since the last successful check
+	MaxSuccessAge time.Duration `yaml:"max_success_age"`
+	// Sentinel watches the local network during tidy
+	Sentinel *AppTidySentinelConfig `yaml:"sentinel"`
+}
+
+type AppTidySentinelConfig struct {
+	Enable bool `yaml:"enable"`
+	// Interval is the interval of the network checks, Timeout is the timeout of every check
+	Interval time.Duration `yaml:"interval"`
+	Timeout  time.Duration `yaml:"timeout"`
+	// the workers are paused and the network is checked if the failure ratio of the latest
+	// SpikeWindow validations reaches SpikeRatio
+	SpikeWindow int     `yaml:"spike_window"`
+	SpikeRatio  float64 `yaml:"spike_ratio"`
+	// MaxPause is the max duration to wait for the network, tidy is aborted then
+	MaxPause time.Duration `yaml:"max_pause"`
 }
 
 type AppSummaryConfig struct {
@@ -50,6 +90,15 @@ type AppProxyConfig struct {
 	ProxyCountryCodes    string `yaml:"proxy_country_codes"`
 	ProxyNotCountryCodes string `yaml:"proxy_not_country_codes"`
 	ProxyID              uint   `yaml:"proxy_id"`
+	// Sort is one of delay, reliability and speed, random if empty
+	Sort string `yaml:"sort"`
+	// ExitCountry filters the proxies by the exit countries instead of the server countries,
+	// the proxies whose exits are unknown are excluded by both the country codes and the not country codes
+	ExitCountry bool `yaml:"exit_country"`
+	// Profile filters the proxies which pass the validation profile
+	Profile string `yaml:"profile"`
+	// MinSpeed filters the proxies by the download speed in kbps
+	MinSpeed uint `yaml:"min_speed"`
 }
 
 type AppExportConfig struct {
@@ -59,6 +108,15 @@ type AppExportConfig struct {
 	ProxyCountryCodes    string `yaml:"proxy_country_codes"`
 	ProxyNotCountryCodes string `yaml:"proxy_not_country_codes"`
 	ProxyID              uint   `yaml:"proxy_id"`
+	// Sort is one of delay, reliability and speed
+	Sort string `yaml:"sort"`
+	// ExitCountry filters the proxies by the exit countries instead of the server countries,
+	// the proxies whose exits are unknown are excluded by both the country codes and the not country codes
+	ExitCountry bool `yaml:"exit_country"`
+	// Profile filters the proxies which pass the validation profile
+	Profile string `yaml:"profile"`
+	// MinSpeed filters the proxies by the download speed in kbps
+	MinSpeed uint `yaml:"min_speed"`
 }
 
 type LogConfig struct {
@@ -70,10 +128,93 @@ type ParserExecutor struct {
 	Enable  bool          `yaml:"enable"`
 	Timeout time.Duration `yaml:"deadline"`
 	FileURL string        `yaml:"file_url"`
+	// FilePath is a local file, directory or glob pattern, "-" reads the standard input.
+	FilePath string `yaml:"file_path,omitempty"`
+	// Format is the body format of FileURL: "auto" (default), "base64", "links", "clash" or "singbox".
+	Format string `yaml:"format,omitempty"`
+	// Scraper declares a generic HTML scraper.
+	Scraper *ParserScraper `yaml:"scraper,omitempty"`
+	// Headers are sent with the requests of the executor, in addition to the parser http headers.
+	Headers map[string]string `yaml:"headers,omitempty"`
+	// Command is an external program which writes links or JSON records to stdout, one per line.
+	Command string   `yaml:"command,omitempty"`
+	Args    []string `yaml:"args,omitempty"`
+}
+
+// LocalPath returns the local path of the executor, file_url with the file scheme is accepted as well.
+func (e *ParserExecutor) LocalPath() string {
+	if e.FilePath != "" {
+		return e.FilePath
+	}
+	if strings.HasPrefix(e.FileURL, "file://") {
+		return strings.TrimPrefix(e.FileURL, "file://")
+	}
+	return ""
+}
+
+// Local reports whether the executor reads a local file or the standard input.
+func (e *ParserExecutor) Local() bool {
+	return e.Command == "" && e.Scraper == nil && e.LocalPath() != ""
+}
+
+// ParserScraper describes how to get links from a website,
+// starts from URL, follows the post link and the follow steps, then extracts links from the last page.
+type ParserScraper struct {
+	URL          string               `yaml:"url"`
+	PostSelector string               `yaml:"post_selector,omitempty"`
+	Follow       []*ParserScraperStep `yaml:"follow,omitempty"`
+	// LinkSelector selects the elements containing links, the whole body if empty.
+	LinkSelector string `yaml:"link_selector,omitempty"`
+	// LinkAttr reads links from the attribute instead of the text of the elements.
+	LinkAttr string `yaml:"link_attr,omitempty"`
+	// LinkRegex extracts links from the text, the first submatch is used if the regex has groups.
+	LinkRegex string `yaml:"link_regex,omitempty"`
+}
+
+type ParserScraperStep struct {
+	Selector string `yaml:"selector"`
+	// Attr is the attribute holding the next page URL, "href" if empty.
+	Attr string `yaml:"attr,omitempty"`
 }
 
 type ParserConfig struct {
-	Executors []*ParserExecutor `yaml:"executors"`
+	Executors []*ParserExecutor      `yaml:"executors"`
+	Discovery *ParserDiscoveryConfig `yaml:"discovery"`
+	// ConditionalFetch skips the file_url sources which have not changed since the last fetch.
+	ConditionalFetch bool              `yaml:"conditional_fetch"`
+	HTTP             *ParserHTTPConfig `yaml:"http"`
+	// Force fetches the sources even if they have not changed, the caches are still updated.
+	Force bool `yaml:"-"`
+}
+
+// ParserHTTPConfig configures the HTTP client shared by the parser executors.
+type ParserHTTPConfig struct {
+	Timeout time.Duration `yaml:"timeout"`
+	// Retry is the retry count on network errors and 5xx status codes.
+	Retry int `yaml:"retry"`
+	// RetryBackoff is the wait before the first retry, it is doubled for each retry.
+	RetryBackoff time.Duration     `yaml:"retry_backoff"`
+	UserAgent    string            `yaml:"user_agent"`
+	Headers      map[string]string `yaml:"headers,omitempty"`
+	// Proxy is the upstream proxy URL, http, https and socks5 schemes are supported.
+	Proxy string `yaml:"proxy,omitempty"`
+	// MaxConnsPerHost limits the concurrent requests to every host, no limit if zero.
+	MaxConnsPerHost int `yaml:"max_conns_per_host"`
+}
+
+// ParserDiscoveryConfig controls fetching the subscription URLs found in the source contents.
+// It is disabled by default, every source does up to MaxFetches extra requests to the linked URLs when enabled.
+type ParserDiscoveryConfig struct {
+	Enable bool `yaml:"enable"`
+	// MaxDepth is how many levels of nested subscriptions are followed.
+	MaxDepth int `yaml:"max_depth"`
+	// MaxFetches limits the subscriptions fetched for each source.
+	MaxFetches int `yaml:"max_fetches"`
+	// Pattern decides if a URL looks like a subscription.
+	Pattern string `yaml:"pattern"`
+	// AllowedDomains limits the subscription domains, subdomains are included, all domains are allowed if empty.
+	AllowedDomains []string `yaml:"allowed_domains,omitempty"`
+	DeniedDomains  []string `yaml:"denied_domains,omitempty"`
 }
 
 type ValidatorConfig struct {
@@ -82,20 +223,110 @@ type ValidatorConfig struct {
 	TestURLCount          int           `yaml:"test_url_count"`
 	TestURLTimeout        time.Duration `yaml:"test_url_timeout"`
 	GetCountryInfoTimeout time.Duration `yaml:"get_country_info_timeout"`
+	// GeoIPDatabasePath is the path of a MaxMind country mmdb database, the countries are looked up offline if set
+	GeoIPDatabasePath string `yaml:"geoip_database_path"`
+	// GeoIPHTTPFallback looks up the countries by ip-api.com if the database is not set or has no record
+	GeoIPHTTPFallback bool `yaml:"geoip_http_fallback"`
+	// ExitIPURL echoes the client IP in plain text or JSON, it is requested through the proxies
+	// to learn the exit IPs, disabled if empty
+	ExitIPURL     string        `yaml:"exit_ip_url"`
+	ExitIPTimeout time.Duration `yaml:"exit_ip_timeout"`
+	// ExitIPTTL is how long the exit IP of a proxy is trusted, it is looked up again in tidy after that
+	ExitIPTTL time.Duration `yaml:"exit_ip_ttl"`
+	// Profiles are checked after the proxies pass the validation, the results are saved per profile
+	Profiles []*ValidatorProfile `yaml:"profiles"`
+	// ProfilesTimeout bounds the time to check all the profiles of a proxy, the profiles are checked concurrently
+	ProfilesTimeout time.Duration `yaml:"profiles_timeout"`
+	// Throughput measures the download speed of the proxies in tidy
+	Throughput *ValidatorThroughputConfig `yaml:"throughput"`
+	// UDP checks the UDP relay of the proxies in tidy by a DNS query
+	UDP *ValidatorUDPConfig `yaml:"udp"`
+	// PreCheck connects to the proxy servers before the validation, the unreachable ones are not validated
+	PreCheck *ValidatorPreCheckConfig `yaml:"pre_check"`
+}
+
+type ValidatorPreCheckConfig struct {
+	Enable  bool          `yaml:"enable"`
+	Timeout time.Duration `yaml:"timeout"`
+	// TLS does the TLS handshake as well for the proxies over TLS
+	TLS    bool `yaml:"tls"`
+	Worker int  `yaml:"worker"`
+}
+
+type ValidatorUDPConfig struct {
+	Enable bool `yaml:"enable"`
+	// Resolver is the address of the DNS server, it must be an IP with port
+	Resolver string `yaml:"resolver"`
+	Domain   string `yaml:"domain"`
+	// Timeout is the wait for the answer of every attempt, a new query is sent in every attempt
+	Timeout  time.Duration `yaml:"timeout"`
+	Attempts int           `yaml:"attempts"`
+}
+
+type ValidatorThroughputConfig struct {
+	Enable bool   `yaml:"enable"`
+	URL    string `yaml:"url"`
+	// the download stops after Duration or MaxBytes, whichever comes first
+	Duration time.Duration `yaml:"duration"`
+	MaxBytes int64         `yaml:"max_bytes"`
+}
+
+type ValidatorProfile struct {
+	Name    string             `yaml:"name"`
+	Targets []*ValidatorTarget `yaml:"targets"`
+	// Count is the number of requests to every target
+	Count   int           `yaml:"count"`
+	Timeout time.Duration `yaml:"timeout"`
+	// Aggregation is one of min, avg and p95, the delay of the profile is aggregated from all the successful requests
+	Aggregation string `yaml:"aggregation"`
+}
+
+type ValidatorTarget struct {
+	URL string `yaml:"url"`
+	// ExpectedStatus is the accepted status codes, any status code below 400 if empty
+	ExpectedStatus []int `yaml:"expected_status"`
+	// ExpectedBody is a substring the response body must contain
+	ExpectedBody string `yaml:"expected_body"`
 }
 
 type StorageConfig struct {
 	Driver string `yaml:"driver"`
 	DSN    string `yaml:"dsn"`
+	// CheckWindow is the number of latest checks to derive the proxy metrics, the older checks are removed,
+	// so it should not be less than the windows of the tidy policy
+	CheckWindow int `yaml:"check_window"`
 }
 
 func DefaultConfig() *Config {
 	homeDir, _ := os.UserHomeDir()
 	c := &Config{
 		App: &AppConfig{
-			Fetch:  &AppFetchConfig{Worker: 300},
-			Tidy:   &AppTidyConfig{Worker: 300},
-			Export: &AppExportConfig{ProxyCount: 100},
+			Fetch: &AppFetchConfig{
+				Worker:         300,
+				BootstrapCount: 5,
+				Backoff: &AppFetchBackoffConfig{
+					Enable:       true,
+					Threshold:    3,
+					BaseInterval: 6 * time.Hour,
+					MaxInterval:  7 * 24 * time.Hour,
+				},
+			},
+			Tidy: &AppTidyConfig{
+				Worker:                 300,
+				MaxConsecutiveFailures: 3,
+				MaxFailureRatio:        0.8,
+				FailureWindow:          10,
+				MaxSuccessAge:          7 * 24 * time.Hour,
+				Sentinel: &AppTidySentinelConfig{
+					Enable:      true,
+					Interval:    10 * time.Second,
+					Timeout:     5 * time.Second,
+					SpikeWindow: 50,
+					SpikeRatio:  0.95,
+					MaxPause:    2 * time.Minute,
+				},
+			},
+			Export: &AppExportConfig{ProxyCount: 100, Sort: "delay"},
 			Proxy: &AppProxyConfig{
 				BindAddress:  "127.0.0.1",
 				Port:         10000,
@@ -104,6 +335,7 @@ func DefaultConfig() *Config {
 			Summary: &AppSummaryConfig{},
 		},
 		Parser: &ParserConfig{
+			ConditionalFetch: true,
 			Executors: []*ParserExecutor{
 				{Name: "cfmem"},
 				{Name: "freefq_ss"},
@@ -132,6 +364,19 @@ func DefaultConfig() *Config {
 				{Name: "wrfree/free/v2", FileURL: "https://raw.githubusercontent.com/wrfree/free/main/v2"},
 				{Name: "ThekingMX1998/free-v2ray-code", FileURL: "https://raw.githubusercontent.com/GreenFishStudio/GreenFish/master/Subscription/GreenFishYYDS"},
 			},
+			HTTP: &ParserHTTPConfig{
+				Timeout:         10 * time.Second,
+				Retry:           2,
+				RetryBackoff:    time.Second,
+				UserAgent:       "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/97.0.4692.99 Safari/537.36",
+				MaxConnsPerHost: 8,
+			},
+			Discovery: &ParserDiscoveryConfig{
+				Enable:     false,
+				MaxDepth:   1,
+				MaxFetches: 10,
+				Pattern:    `(?i)(sub|clash|token=|\.ya?ml|\.txt|/link/|v2ray|/ssr?\b|/trojan)`,
+			},
 		},
 		Validator: &ValidatorConfig{
 			TestNetworkURL:        "https://www.baidu.com",
@@ -139,10 +384,33 @@ func DefaultConfig() *Config {
 			TestURLCount:          3,
 			TestURLTimeout:        10 * time.Second,
 			GetCountryInfoTimeout: 5 * time.Second,
+			GeoIPHTTPFallback:     true,
+			ExitIPURL:             "https://api.ipify.org",
+			ExitIPTimeout:         10 * time.Second,
+			ExitIPTTL:             7 * 24 * time.Hour,
+			ProfilesTimeout:       30 * time.Second,
+			Throughput: &ValidatorThroughputConfig{
+				URL:      "https://speed.cloudflare.com/__down?bytes=10000000",
+				Duration: 10 * time.Second,
+				MaxBytes: 10000000,
+			},
+			UDP: &ValidatorUDPConfig{
+				Enable:   true,
+				Resolver: "8.8.8.8:53",
+				Domain:   "www.google.com",
+				Timeout:  3 * time.Second,
+				Attempts: 3,
+			},
+			PreCheck: &ValidatorPreCheckConfig{
+				Enable:  true,
+				Timeout: 3 * time.Second,
+				Worker:  500,
+			},
 		},
 		Storage: &StorageConfig{
-			Driver: "sqlite",
-			DSN:    fmt.Sprintf("%s/.config/freeproxy/freeproxy.db", homeDir),
+			Driver:      "sqlite",
+			DSN:         fmt.Sprintf("%s/.config/freeproxy/freeproxy.db", homeDir),
+			CheckWindow: 20,
 		},
 		Log: &LogConfig{
 			Level: zapcore.InfoLevel,
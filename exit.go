@@ -0,0 +1,31 @@
+package freeproxy
+
+import (
+	"context"
+	"time"
+
+	"github.com/xwjdsh/freeproxy/proxy"
+	"github.com/xwjdsh/freeproxy/storage"
+	"github.com/xwjdsh/freeproxy/validator"
+)
+
+// updateIPs sets the entry IP of the proxy, and the exit IP with its country if the stored one is stale.
+// The exit IP may differ from the server IP for the relayed or CDN fronted proxies.
+func (h *Handler) updateIPs(ctx context.Context, p *storage.Proxy, pp proxy.Proxy) {
+	if ip, err := h.validator.EntryIP(ctx, p.Server); err == nil {
+		p.EntryIP = ip
+	}
+	// the exit IP is looked up through the proxy, which is not possible for the unvalidated types
+	if !validator.Supported(p.Type) || !h.validator.ExitIPStale(p.ExitCheckedAt) {
+		return
+	}
+	// a failed lookup keeps the stale IP, it is retried next time
+	if ip, err := h.validator.ExitIP(ctx, pp); err == nil && ip != "" {
+		if ip != p.ExitIP || p.ExitCountryCode == "" {
+			p.ExitCountryCode, p.ExitCountry, _ = h.validator.GetCountryInfo(ctx, ip)
+		}
+		p.ExitIP = ip
+		now := time.Now()
+		p.ExitCheckedAt = &now
+	}
+}
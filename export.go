@@ -13,6 +13,7 @@ import (
 	emoji "github.com/jayco/go-emoji-flag"
 
 	"github.com/xwjdsh/freeproxy/storage"
+	"github.com/xwjdsh/freeproxy/validator"
 )
 
 //go:embed clash.tmpl
@@ -21,6 +22,14 @@ var defaultTemplate string
 type RenderItem struct {
 	Proxy  *storage.Proxy
 	Config string
+	Link   string
+	// Sources are the sources where the proxy has been seen, the earliest first
+	Sources []*storage.ProxySource
+	// Profiles are the latest validation profile results
+	Profiles []*storage.ProfileResult
+	// Validated is false for the types which are stored without the validation,
+	// they need a client core which supports them
+	Validated bool
 }
 
 type RenderData struct {
@@ -39,10 +48,27 @@ func (h *Handler) Export(ctx context.Context) error {
 		CountryCodes:    cfg.ProxyCountryCodes,
 		NotCountryCodes: cfg.ProxyNotCountryCodes,
 		Count:           cfg.ProxyCount,
-		Fast:            true,
+		Sort:            cfg.Sort,
+		Healthy:         cfg.ProxyID == 0,
+		ExitCountry:     cfg.ExitCountry,
+		Profile:         cfg.Profile,
+		MinSpeed:        cfg.MinSpeed,
 	})
 	if err != nil {
-		return nil
+		return err
+	}
+
+	ids := make([]uint, 0, len(ps))
+	for _, p := range ps {
+		ids = append(ids, p.ID)
+	}
+	sourcesMap, err := h.storage.GetProxySources(ctx, ids)
+	if err != nil {
+		return err
+	}
+	profilesMap, err := h.storage.GetProfileResults(ctx, ids)
+	if err != nil {
+		return err
 	}
 
 	rd := &RenderData{
@@ -54,15 +80,30 @@ func (h *Handler) Export(ctx context.Context) error {
 			countryEmoji := emoji.GetFlag(p.CountryCode)
 			p.Name = fmt.Sprintf("%s-%s-%d", countryEmoji, p.CountryCode, p.ID)
 			m["name"] = p.Name
+			// the measured result overrides what the source claims
+			if p.UDPOK != nil {
+				m["udp"] = *p.UDPOK
+			}
 		}
 		data, err := json.Marshal(m)
 		if err != nil {
 			return err
 		}
-		rd.Items = append(rd.Items, &RenderItem{
-			Proxy:  p,
-			Config: string(data),
-		})
+		item := &RenderItem{
+			Proxy:     p,
+			Config:    string(data),
+			Sources:   sourcesMap[p.ID],
+			Profiles:  profilesMap[p.ID],
+			Validated: validator.Supported(p.Type),
+		}
+		// Restore shares the base with p and resets the name from the stored config
+		name := p.Name
+		pp, err := p.Restore(p.Config)
+		p.Name = name
+		if err == nil {
+			item.Link, _ = pp.ToLink()
+		}
+		rd.Items = append(rd.Items, item)
 	}
 
 	text := defaultTemplate
@@ -0,0 +1,67 @@
+package freeproxy
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xwjdsh/freeproxy/config"
+	"github.com/xwjdsh/freeproxy/proxy"
+	"github.com/xwjdsh/freeproxy/storage"
+	"github.com/xwjdsh/freeproxy/validator"
+)
+
+func TestExport(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	cfg := config.DefaultConfig()
+	cfg.Storage.DSN = filepath.Join(dir, "db")
+	cfg.App.Export.OutputFilePath = filepath.Join(dir, "clash.yaml")
+	s, err := storage.Init(cfg.Storage)
+	require.Nil(t, err)
+	v, err := validator.New(&config.ValidatorConfig{})
+	require.Nil(t, err)
+	h := &Handler{cfg: cfg.App, validator: v, storage: s}
+
+	for _, link := range []string{
+		`hysteria://1.2.3.4:36712?protocol=udp&auth=secret&peer=example.com&upmbps=50&downmbps=100`,
+		`hysteria2://letmein@5.6.7.8:443/?sni=real.example.com&obfs=salamander&obfs-password=gawrgura`,
+	} {
+		p, err := proxy.NewProxyByLink(link)
+		require.Nil(t, err)
+		_, _, err = s.Create(ctx, p)
+		require.Nil(t, err)
+	}
+	p, err := proxy.NewProxyByConfigMap(map[string]interface{}{
+		"type": "ss", "server": "9.9.9.9", "port": 8388, "cipher": "aes-128-gcm", "password": "x",
+	})
+	require.Nil(t, err)
+	_, _, err = s.Create(ctx, p)
+	require.Nil(t, err)
+
+	require.Nil(t, h.Export(ctx))
+	data, err := ioutil.ReadFile(cfg.App.Export.OutputFilePath)
+	require.Nil(t, err)
+
+	lines := map[string]string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		for _, server := range []string{"1.2.3.4", "5.6.7.8", "9.9.9.9"} {
+			if strings.Contains(line, `"server":"`+server+`"`) {
+				lines[server] = line
+			}
+		}
+	}
+	require.Len(t, lines, 3)
+	// the unvalidated proxies are exported with a note for the client core
+	assert.Contains(t, lines["1.2.3.4"], `"type":"hysteria"`)
+	assert.Contains(t, lines["1.2.3.4"], "# hysteria is not validated")
+	assert.Contains(t, lines["5.6.7.8"], `"type":"hysteria2"`)
+	assert.Contains(t, lines["5.6.7.8"], "# hysteria2 is not validated")
+	assert.NotContains(t, lines["9.9.9.9"], "#")
+}
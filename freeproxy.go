@@ -2,16 +2,21 @@ package freeproxy
 
 import (
 	"context"
+	"fmt"
 	"io/ioutil"
+	"net"
 	"os"
 	"sort"
 	"strconv"
 	"sync"
 	"text/template"
+	"time"
 
 	"github.com/fatih/color"
+	"github.com/google/uuid"
 	emoji "github.com/jayco/go-emoji-flag"
 	"github.com/olekukonko/tablewriter"
+	"go.uber.org/zap"
 
 	"github.com/xwjdsh/freeproxy/config"
 	"github.com/xwjdsh/freeproxy/internal/counter"
@@ -23,33 +28,94 @@ import (
 	"github.com/xwjdsh/freeproxy/validator"
 )
 
+// proxyValidator is what the handler needs from the validator, it is implemented by *validator.Validator.
+type proxyValidator interface {
+	CheckNetwork(ctx context.Context) error
+	NewSentinel(cfg *config.AppTidySentinelConfig) *validator.Sentinel
+	PreCheckEnabled() bool
+	PreCheckWorker() int
+	PreCheck(ctx context.Context, p proxy.Proxy) error
+	Validate(ctx context.Context, p proxy.Proxy) error
+	Dialer(p proxy.Proxy) (func(ctx context.Context, network, address string) (net.Conn, error), error)
+	GetCountryInfo(ctx context.Context, server string) (string, string, error)
+	GetTestURL() string
+	EntryIP(ctx context.Context, server string) (string, error)
+	ExitIP(ctx context.Context, p proxy.Proxy) (string, error)
+	ExitIPStale(checkedAt *time.Time) bool
+	Profiles() []*config.ValidatorProfile
+	ValidateProfiles(ctx context.Context, p proxy.Proxy) []*validator.ProfileResult
+	ThroughputEnabled() bool
+	Throughput(ctx context.Context, p proxy.Proxy) (uint, error)
+	UDPEnabled() bool
+	CheckUDP(ctx context.Context, p proxy.Proxy) error
+}
+
 type Handler struct {
 	cfg       *config.AppConfig
 	parser    *parser.Handler
-	validator *validator.Validator
+	validator proxyValidator
 	storage   *storage.Handler
+	// backoffExempt are the local sources, e.g. the standard input, which are never backed off
+	backoffExempt map[string]bool
 }
 
 func Init(cfg *config.Config) (*Handler, error) {
 	log.Init(cfg.Log)
 
+	if w := cfg.Storage.CheckWindow; w > 0 && checkWindow(cfg.App.Tidy) > w {
+		return nil, fmt.Errorf("freeproxy: the tidy failure windows exceed the storage check window %d", w)
+	}
+
 	h, err := storage.Init(cfg.Storage)
 	if err != nil {
 		return nil, err
 	}
-	p, err := parser.Init(cfg.Parser)
+	p, err := parser.Init(cfg.Parser, &parserCache{storage: h})
+	if err != nil {
+		return nil, err
+	}
+	v, err := validator.New(cfg.Validator)
 	if err != nil {
 		return nil, err
 	}
 	return &Handler{
-		cfg:       cfg.App,
-		parser:    p,
-		validator: validator.New(cfg.Validator),
-		storage:   h,
+		cfg:           cfg.App,
+		parser:        p,
+		validator:     v,
+		storage:       h,
+		backoffExempt: backoffExempt(cfg.Parser),
+	}, nil
+}
+
+// parserCache saves the parser source caches to storage.
+type parserCache struct {
+	storage *storage.Handler
+}
+
+func (c *parserCache) GetSourceCache(ctx context.Context, source string) (*parser.SourceCache, error) {
+	sc, err := c.storage.GetSourceCache(ctx, source)
+	if err != nil || sc == nil {
+		return nil, err
+	}
+	return &parser.SourceCache{
+		ETag:         sc.ETag,
+		LastModified: sc.LastModified,
+		ContentHash:  sc.ContentHash,
 	}, nil
 }
 
-func (h *Handler) Tidy(ctx context.Context, quiet bool) error {
+func (c *parserCache) SaveSourceCache(ctx context.Context, source string, sc *parser.SourceCache) error {
+	return c.storage.SaveSourceCache(ctx, &storage.SourceCache{
+		Name:         source,
+		ETag:         sc.ETag,
+		LastModified: sc.LastModified,
+		ContentHash:  sc.ContentHash,
+	})
+}
+
+// Tidy validates the saved proxies, the failed ones are marked as unhealthy and removed by the tidy policy.
+// Nothing is changed in dry run mode, the proxies which would be removed are listed.
+func (h *Handler) Tidy(ctx context.Context, quiet bool, dryRun bool) error {
 	ps, err := h.storage.GetProxies(ctx, &storage.QueryOptions{})
 	if err != nil {
 		return err
@@ -59,6 +125,33 @@ func (h *Handler) Tidy(ctx context.Context, quiet bool) error {
 		return err
 	}
 
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		sentinel  *validator.Sentinel
+		abortErr  error
+		abortOnce sync.Once
+	)
+	if cfg := h.cfg.Tidy.Sentinel; cfg != nil && cfg.Enable {
+		sentinel = h.validator.NewSentinel(cfg)
+		go sentinel.Run(ctx)
+	}
+	// wait returns the sentinel epoch, tidy is aborted if the network is down for too long
+	wait := func() (int, error) {
+		if sentinel == nil {
+			return 0, ctx.Err()
+		}
+		epoch, err := sentinel.Wait(ctx)
+		if err != nil {
+			abortOnce.Do(func() {
+				abortErr = err
+				cancel()
+			})
+		}
+		return epoch, err
+	}
+
 	var pb progressbar.ProgressBar
 	if quiet {
 		pb = progressbar.NewMock()
@@ -69,43 +162,176 @@ func (h *Handler) Tidy(ctx context.Context, quiet bool) error {
 
 	bar := pb.Bar("")
 	proxyChan := make(chan *storage.Proxy)
+	// tidyTask is a restored proxy with its pre-check error and the sentinel epoch of the pre-check
+	type tidyTask struct {
+		p           *storage.Proxy
+		pp          proxy.Proxy
+		epoch       int
+		preCheckErr error
+	}
+	taskChan := make(chan *tidyTask)
 
 	var (
 		removedCount      counter.Count
+		unhealthyCount    counter.Count
+		discardedCount    counter.Count
 		setCountryCount   counter.Count
 		emptyCountryCount counter.Count
+		unvalidatedCount  counter.Count
+		reachableCount    counter.Count
+		unreachableCount  counter.Count
+
+		evicted      []*storage.Proxy
+		evictReasons = map[uint]string{}
+		evictMutex   sync.Mutex
 	)
 
-	worker := h.cfg.Tidy.Worker
+	setSuffix := func() {
+		suffix := fmt.Sprintf("removed: %d, unhealthy: %d, discarded: %d, unvalidated: %d, setCountry: %d, emptyCountry: %d", removedCount.Get(), unhealthyCount.Get(), discardedCount.Get(), unvalidatedCount.Get(), setCountryCount.Get(), emptyCountryCount.Get())
+		if h.validator.PreCheckEnabled() {
+			suffix = fmt.Sprintf("reachable: %d, unreachable: %d, %s", reachableCount.Get(), unreachableCount.Get(), suffix)
+		}
+		bar.SetSuffix(suffix)
+	}
+
+	// the pre-check stage connects to the proxy servers, the unreachable proxies are not validated
+	// but go through the tidy policy as failures
+	preCheckWorker := h.cfg.Tidy.Worker
+	if h.validator.PreCheckEnabled() {
+		preCheckWorker = h.validator.PreCheckWorker()
+	}
+	preCheckWg := sync.WaitGroup{}
+	preCheckWg.Add(preCheckWorker)
+
+	for i := 0; i < preCheckWorker; i++ {
+		go func() {
+			defer preCheckWg.Done()
+
+			for p := range proxyChan {
+				pp, err := p.Restore(p.Config)
+				if err != nil {
+					bar.Incr()
+					continue
+				}
+				// the proxies which can not be validated are kept as they are, only the country is filled
+				if !validator.Supported(p.Type) {
+					if p.CountryCode == "" && !dryRun {
+						if p.CountryCode, p.Country, _ = h.validator.GetCountryInfo(ctx, p.Server); p.CountryCode != "" {
+							setCountryCount.Inc()
+							_ = h.storage.Update(ctx, p)
+						} else {
+							emptyCountryCount.Inc()
+						}
+					}
+					unvalidatedCount.Inc()
+					setSuffix()
+					bar.Incr()
+					continue
+				}
+
+				t := &tidyTask{p: p, pp: pp}
+				if h.validator.PreCheckEnabled() {
+					if t.epoch, err = wait(); err != nil {
+						bar.Incr()
+						continue
+					}
+					if t.preCheckErr = h.validator.PreCheck(ctx, pp); t.preCheckErr == nil {
+						reachableCount.Inc()
+					} else if ctx.Err() == nil {
+						unreachableCount.Inc()
+					}
+				}
+				taskChan <- t
+			}
+		}()
+	}
+
+	validateWorker := h.cfg.Tidy.Worker
 	wg := sync.WaitGroup{}
-	wg.Add(worker)
+	wg.Add(validateWorker)
 
-	for i := 0; i < worker; i++ {
+	for i := 0; i < validateWorker; i++ {
 		go func() {
 			defer wg.Done()
 
 			for {
 				select {
-				case p, ok := <-proxyChan:
+				case t, ok := <-taskChan:
 					if !ok {
 						return
 					}
 
+					p, pp := t.p, t.pp
 					if err := func() error {
 						defer func() {
-							bar.SetSuffix("removed: %d, setCountry: %d, emptyCountry: %d", removedCount.Get(), setCountryCount.Get(), emptyCountryCount.Get())
+							setSuffix()
 							bar.Incr()
 						}()
 
-						pp, err := p.Restore(p.Config)
-						if err != nil {
-							return err
+						epoch, err := t.epoch, t.preCheckErr
+						if err == nil {
+							if epoch, err = wait(); err != nil {
+								return err
+							}
+							err = h.validator.Validate(ctx, pp)
 						}
-						if err := h.validator.Validate(ctx, pp); err != nil {
-							err := h.storage.Remove(ctx, p.ID)
-							if err == nil {
-								removedCount.Inc()
+						if ctx.Err() != nil {
+							return ctx.Err()
+						}
+						if sentinel != nil {
+							sentinel.Report(err == nil)
+							if err != nil {
+								// the failure is not trusted if the network went down during the validation
+								current, werr := wait()
+								if werr != nil {
+									return werr
+								}
+								if current != epoch {
+									discardedCount.Inc()
+									return err
+								}
+							}
+						}
+						check := &storage.Check{
+							CreatedAt:  time.Now(),
+							ProxyID:    p.ID,
+							Delay:      p.Delay,
+							Success:    err == nil,
+							ErrorClass: validator.ErrorClass(err),
+						}
+						if err != nil {
+							checks, cerr := h.storage.GetChecks(ctx, p.ID, checkWindow(h.cfg.Tidy))
+							if cerr != nil {
+								return cerr
+							}
+							checks = append([]*storage.Check{check}, checks...)
+
+							reason := evictReason(h.cfg.Tidy, p, checks, check.CreatedAt)
+							if reason != "" {
+								evictMutex.Lock()
+								evicted = append(evicted, p)
+								evictReasons[p.ID] = reason
+								evictMutex.Unlock()
 							}
+							if dryRun {
+								return err
+							}
+
+							if reason == "" {
+								unhealthyCount.Inc()
+								_, cerr := h.storage.RecordCheck(ctx, check)
+								return cerr
+							}
+							if err := h.storage.Remove(ctx, p.ID); err != nil {
+								return err
+							}
+							removedCount.Inc()
+							return nil
+						}
+						if dryRun {
+							return nil
+						}
+						if _, err := h.storage.RecordCheck(ctx, check); err != nil {
 							return err
 						}
 
@@ -118,6 +344,18 @@ func (h *Handler) Tidy(ctx context.Context, quiet bool) error {
 							}
 						}
 
+						h.updateIPs(ctx, p, pp)
+						if err := h.checkProfiles(ctx, p.ID, pp); err != nil {
+							return err
+						}
+						if h.validator.ThroughputEnabled() {
+							p.Speed, _ = h.validator.Throughput(ctx, pp)
+						}
+						if h.validator.UDPEnabled() {
+							ok := h.validator.CheckUDP(ctx, pp) == nil
+							p.UDPOK = &ok
+						}
+
 						return h.storage.Update(ctx, p)
 					}(); err != nil {
 						// TODO log
@@ -127,19 +365,65 @@ func (h *Handler) Tidy(ctx context.Context, quiet bool) error {
 		}()
 	}
 
+feed:
 	for _, p := range ps {
-		p := p
-		proxyChan <- p
+		select {
+		case proxyChan <- p:
+		case <-ctx.Done():
+			break feed
+		}
 	}
 	close(proxyChan)
 
-	pb.Wait()
+	preCheckWg.Wait()
+	close(taskChan)
 	wg.Wait()
+	if ctx.Err() != nil {
+		bar.TriggerComplete()
+	}
+	pb.Wait()
+
+	if abortErr != nil {
+		return abortErr
+	}
+
+	if !dryRun && ctx.Err() == nil {
+		// the results of the removed profiles are not shown or filtered by any more
+		names := []string{}
+		for _, p := range h.validator.Profiles() {
+			names = append(names, p.Name)
+		}
+		if err := h.storage.PruneProfileResults(ctx, names); err != nil {
+			return err
+		}
+	}
+
+	if dryRun {
+		sort.Slice(evicted, func(i, j int) bool {
+			return evicted[i].ID < evicted[j].ID
+		})
+
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetAutoFormatHeaders(false)
+		table.SetHeader([]string{"ID", "Type", "Address", "Source", "Reason"})
+		table.SetBorder(false)
+		for _, p := range evicted {
+			table.Append([]string{strconv.Itoa(int(p.ID)), p.Type.String(), net.JoinHostPort(p.Server, strconv.Itoa(p.Port)), p.Source, evictReasons[p.ID]})
+		}
+		table.Render()
+		fmt.Printf("%d of %d proxies would be removed\n", len(evicted), len(ps))
+	}
 
 	return nil
 }
 
 func (h *Handler) Fetch(ctx context.Context, quiet bool) error {
+	if h.cfg.Fetch.Bootstrap {
+		if err := h.bootstrap(ctx); err != nil {
+			return err
+		}
+	}
+
 	var pb progressbar.ProgressBar
 	if quiet {
 		pb = progressbar.NewMock()
@@ -147,89 +431,249 @@ func (h *Handler) Fetch(ctx context.Context, quiet bool) error {
 		pb = progressbar.New()
 	}
 
-	parserResultChan := make(chan *parser.Result)
-
-	worker := h.cfg.Fetch.Worker
-	wg := sync.WaitGroup{}
-	wg.Add(worker)
+	states, err := h.SourceStates(ctx)
+	if err != nil {
+		return err
+	}
+	skip := map[string]bool{}
+	now := time.Now()
+	for _, s := range states {
+		if s.Skipped(now) {
+			skip[s.Name] = true
+			bar := pb.AddBar(s.Name, 0)
+			bar.SetSuffix(color.YellowString("backoff until %s, failures: %d", s.Until.Format("2006-01-02 15:04"), s.Failures))
+			bar.TriggerComplete()
+		}
+	}
 
-	createdCountMap := map[string]int{}
-	createdCountMutex := sync.Mutex{}
+	parserResultChan := make(chan *parser.Result)
+	validateChan := make(chan *parser.Result)
+
+	runID := uuid.New().String()
+	sourceMap := map[string]*storage.Source{}
+	sourceMutex := sync.Mutex{}
+	// updateSource updates the statistics of the source and returns it
+	updateSource := func(name string, f func(s *storage.Source)) storage.Source {
+		sourceMutex.Lock()
+		defer sourceMutex.Unlock()
+
+		s := sourceMap[name]
+		if s == nil {
+			s = &storage.Source{RunID: runID, Name: name}
+			sourceMap[name] = s
+		}
+		f(s)
+		return *s
+	}
 
 	barMutex := sync.Mutex{}
+	getBar := func(source string) progressbar.Bar {
+		barMutex.Lock()
+		defer barMutex.Unlock()
 
-	for i := 0; i < worker; i++ {
-		go func() {
-			defer wg.Done()
+		if b := pb.Bar(source); b != nil {
+			return b
+		}
 
-			for {
-				select {
-				case r, ok := <-parserResultChan:
-					if !ok {
-						return
-					}
+		return pb.AddBar(source, 0)
+	}
+	// suffix shows the counts of the source, the pre-check counts are shown as in tidy
+	suffix := func(s storage.Source) string {
+		suffix := color.GreenString("new: %d", s.Created)
+		if h.validator.PreCheckEnabled() {
+			suffix = fmt.Sprintf("%s, reachable: %d, unreachable: %d", suffix, s.Reachable, s.Unreachable)
+		}
+		return suffix
+	}
+	setSuffix := func(bar progressbar.Bar, s storage.Source) {
+		bar.SetSuffix("%s", suffix(s))
+	}
 
-					source := r.Source
-					bar := func() progressbar.Bar {
-						barMutex.Lock()
-						defer barMutex.Unlock()
+	// pending counts the proxies of every source which are not handled yet
+	pending := map[string]*sync.WaitGroup{}
+	pendingMutex := sync.Mutex{}
+	pendingOf := func(source string) *sync.WaitGroup {
+		pendingMutex.Lock()
+		defer pendingMutex.Unlock()
+
+		wg := pending[source]
+		if wg == nil {
+			wg = &sync.WaitGroup{}
+			pending[source] = wg
+		}
+		return wg
+	}
 
-						if b := pb.Bar(source); b != nil {
-							return b
-						}
+	// sourceDone saves the statistics of the source after its proxies are handled
+	sourceDone := func(r *parser.Result) {
+		source := r.Source
+		bar := getBar(source)
+
+		pendingOf(source).Wait()
+		s := updateSource(source, func(s *storage.Source) {
+			s.Duration = r.Duration
+			s.NotModified = r.NotModified
+			if r.Err != nil {
+				s.Error = r.Err.Error()
+			}
+		})
+		switch {
+		case r.Err != nil:
+			bar.SetSuffix(color.RedString(r.Err.Error()))
+		case r.NotModified:
+			bar.SetSuffix(color.YellowString("not modified"))
+		case r.Format != "":
+			bar.SetSuffix("%s, format: %s", suffix(s), r.Format)
+		}
+		bar.TriggerComplete()
 
-						return pb.AddBar(source, 0)
-					}()
+		if err := h.storage.CreateSource(ctx, &s); err != nil {
+			log.L().Error("freeproxy: save source error", zap.String("source", source), zap.Error(err))
+		}
+		// the source is fetched again next time if the run is aborted
+		if ctx.Err() == nil {
+			if err := h.parser.SaveSourceCache(ctx, r); err != nil {
+				log.L().Error("freeproxy: save source cache error", zap.String("source", source), zap.Error(err))
+			}
+		}
+	}
 
-					if r.SourceDone {
-						if r.Err != nil {
-							bar.SetSuffix(color.RedString(r.Err.Error()))
-						}
+	// the results are dispatched in the parser order, so the proxies of a source are counted before its SourceDone
+	preCheckChan := make(chan *parser.Result)
+	doneWg := sync.WaitGroup{}
+	go func() {
+		defer close(preCheckChan)
+
+		for r := range parserResultChan {
+			source := r.Source
+			switch {
+			case r.SourceDone:
+				doneWg.Add(1)
+				go func(r *parser.Result) {
+					defer doneWg.Done()
+					sourceDone(r)
+				}(r)
+			case r.Err != nil:
+				updateSource(source, func(s *storage.Source) {
+					s.Seen++
+					s.ParseFailed++
+				})
+			default:
+				pendingOf(source).Add(1)
+				getBar(source).TotalInc(1)
+				preCheckChan <- r
+			}
+		}
+	}()
 
-						bar.Wait()
-						bar.TriggerComplete()
+	// the pre-check stage connects to the proxy servers, only the reachable proxies are sent to the validation,
+	// the proxies which can not be validated are sent as they are
+	preCheckWorker := h.cfg.Fetch.Worker
+	if h.validator.PreCheckEnabled() {
+		preCheckWorker = h.validator.PreCheckWorker()
+	}
+	preCheckWg := sync.WaitGroup{}
+	preCheckWg.Add(preCheckWorker)
+
+	for i := 0; i < preCheckWorker; i++ {
+		go func() {
+			defer preCheckWg.Done()
+
+			for r := range preCheckChan {
+				if h.validator.PreCheckEnabled() && validator.Supported(r.Proxy.GetBase().Type) {
+					if err := h.validator.PreCheck(ctx, r.Proxy); err != nil {
+						bar := getBar(r.Source)
+						setSuffix(bar, updateSource(r.Source, func(s *storage.Source) {
+							s.Seen++
+							s.ValidateFailed++
+							s.Unreachable++
+						}))
+						bar.Incr()
+						pendingOf(r.Source).Done()
 						continue
 					}
+					setSuffix(getBar(r.Source), updateSource(r.Source, func(s *storage.Source) {
+						s.Reachable++
+					}))
+				}
+				validateChan <- r
+			}
+		}()
+	}
 
-					bar.TotalInc(1)
+	worker := h.cfg.Fetch.Worker
+	wg := sync.WaitGroup{}
+	wg.Add(worker)
 
-					if err := func() error {
-						defer func() {
-							createdCountMutex.Lock()
-							defer createdCountMutex.Unlock()
+	for i := 0; i < worker; i++ {
+		go func() {
+			defer wg.Done()
 
-							if v := createdCountMap[source]; v > 0 {
-								bar.SetSuffix(color.GreenString("new: %d", v))
-							}
+			for r := range validateChan {
+				source := r.Source
+				bar := getBar(source)
 
-							bar.Incr()
-						}()
+				if err := func() error {
+					var s storage.Source
+					defer func() {
+						setSuffix(bar, s)
+						bar.Incr()
+						pendingOf(source).Done()
+					}()
 
+					// the proxies which the clash adapter can not dial are stored unvalidated
+					supported := validator.Supported(r.Proxy.GetBase().Type)
+					if supported {
 						if err := h.validator.Validate(ctx, r.Proxy); err != nil {
+							s = updateSource(source, func(s *storage.Source) {
+								s.Seen++
+								s.ValidateFailed++
+							})
 							return nil
 						}
-						_, created, err := h.storage.Create(ctx, r.Proxy)
-						if created {
-							func() {
-								createdCountMutex.Lock()
-								defer createdCountMutex.Unlock()
-
-								createdCountMap[source] += 1
-							}()
-						}
-						return err
-					}(); err != nil {
-						// TODO log
 					}
+					sp, ok, err := h.storage.Create(ctx, r.Proxy)
+					if err == nil && supported {
+						_, err = h.storage.RecordCheck(ctx, &storage.Check{
+							ProxyID: sp.ID,
+							Delay:   r.Proxy.GetBase().Delay,
+							Success: true,
+						})
+					}
+					if err == nil && ok && supported {
+						err = h.checkProfiles(ctx, sp.ID, r.Proxy)
+					}
+					if err == nil && ok {
+						h.updateIPs(ctx, sp, r.Proxy)
+						err = h.storage.Update(ctx, sp)
+					}
+					s = updateSource(source, func(s *storage.Source) {
+						s.Seen++
+						if !supported {
+							s.Unsupported++
+						}
+						switch {
+						case ok:
+							s.Created++
+						case err == nil:
+							s.Duplicated++
+						}
+					})
+					return err
+				}(); err != nil {
+					// TODO log
 				}
 			}
 		}()
 	}
 
-	h.parser.Parse(ctx, parserResultChan)
+	h.parser.Parse(ctx, parserResultChan, skip)
 	close(parserResultChan)
 
+	preCheckWg.Wait()
+	close(validateChan)
 	wg.Wait()
+	doneWg.Wait()
 	pb.Wait()
 
 	return nil
@@ -243,12 +687,33 @@ type SummaryGroup struct {
 	ProxyTypeMap map[string]int
 }
 
+// SummarySource shows how many proxies are only seen in the source.
+type SummarySource struct {
+	Name   string
+	Total  int
+	Unique int
+}
+
 type SummaryData struct {
 	Items             []*SummaryGroup
+	Sources           []*SummarySource
 	TotalProxyTypeMap map[string]int
 	Total             int
 }
 
+var summaryColumns = []struct {
+	Type  proxy.Type
+	Title string
+}{
+	{proxy.SS, "SS"},
+	{proxy.SSR, "SSR"},
+	{proxy.Vmess, "Vmess"},
+	{proxy.Trojan, "Trojan"},
+	{proxy.VLESS, "VLESS"},
+	{proxy.Hysteria, "Hysteria"},
+	{proxy.Hysteria2, "Hysteria2"},
+}
+
 func (h *Handler) Summary(ctx context.Context) error {
 	ps, err := h.storage.GetProxies(ctx, nil)
 	if err != nil {
@@ -282,6 +747,34 @@ func (h *Handler) Summary(ctx context.Context) error {
 		return sd.Items[i].Total > sd.Items[j].Total
 	})
 
+	ids := make([]uint, 0, len(ps))
+	for _, p := range ps {
+		ids = append(ids, p.ID)
+	}
+	sourcesMap, err := h.storage.GetProxySources(ctx, ids)
+	if err != nil {
+		return err
+	}
+	sm := map[string]*SummarySource{}
+	for _, p := range ps {
+		pss := sourcesMap[p.ID]
+		for _, s := range pss {
+			ss := sm[s.Source]
+			if ss == nil {
+				ss = &SummarySource{Name: s.Source}
+				sm[s.Source] = ss
+				sd.Sources = append(sd.Sources, ss)
+			}
+			ss.Total += 1
+			if len(pss) == 1 {
+				ss.Unique += 1
+			}
+		}
+	}
+	sort.Slice(sd.Sources, func(i, j int) bool {
+		return sd.Sources[i].Unique > sd.Sources[j].Unique
+	})
+
 	if fp := h.cfg.Summary.TemplateFilePath; fp != "" {
 		data, err := ioutil.ReadFile(fp)
 		if err != nil {
@@ -299,21 +792,11 @@ func (h *Handler) Summary(ctx context.Context) error {
 	data := [][]string{}
 	header := []string{"CountryCode", "Country"}
 	footer := []string{"", "Total"}
-	if v := sd.TotalProxyTypeMap[proxy.SS.String()]; v != 0 {
-		header = append(header, "SS")
-		footer = append(footer, strconv.Itoa(v))
-	}
-	if v := sd.TotalProxyTypeMap[proxy.SSR.String()]; v != 0 {
-		header = append(header, "SSR")
-		footer = append(footer, strconv.Itoa(v))
-	}
-	if v := sd.TotalProxyTypeMap[proxy.Vmess.String()]; v != 0 {
-		header = append(header, "Vmess")
-		footer = append(footer, strconv.Itoa(v))
-	}
-	if v := sd.TotalProxyTypeMap[proxy.Trojan.String()]; v != 0 {
-		header = append(header, "Trojan")
-		footer = append(footer, strconv.Itoa(v))
+	for _, c := range summaryColumns {
+		if v := sd.TotalProxyTypeMap[c.Type.String()]; v != 0 {
+			header = append(header, c.Title)
+			footer = append(footer, strconv.Itoa(v))
+		}
 	}
 	header = append(header, "Total")
 	footer = append(footer, strconv.Itoa(sd.Total))
@@ -323,17 +806,10 @@ func (h *Handler) Summary(ctx context.Context) error {
 			item.CountryEmoji + " " + item.CountryCode, item.Country,
 		}
 
-		if v := sd.TotalProxyTypeMap[proxy.SS.String()]; v != 0 {
-			dataItem = append(dataItem, strconv.Itoa(item.ProxyTypeMap[proxy.SS.String()]))
-		}
-		if v := sd.TotalProxyTypeMap[proxy.SSR.String()]; v != 0 {
-			dataItem = append(dataItem, strconv.Itoa(item.ProxyTypeMap[proxy.SSR.String()]))
-		}
-		if v := sd.TotalProxyTypeMap[proxy.Vmess.String()]; v != 0 {
-			dataItem = append(dataItem, strconv.Itoa(item.ProxyTypeMap[proxy.Vmess.String()]))
-		}
-		if v := sd.TotalProxyTypeMap[proxy.Trojan.String()]; v != 0 {
-			dataItem = append(dataItem, strconv.Itoa(item.ProxyTypeMap[proxy.Trojan.String()]))
+		for _, c := range summaryColumns {
+			if v := sd.TotalProxyTypeMap[c.Type.String()]; v != 0 {
+				dataItem = append(dataItem, strconv.Itoa(item.ProxyTypeMap[c.Type.String()]))
+			}
 		}
 		dataItem = append(dataItem, strconv.Itoa(item.Total))
 		data = append(data, dataItem)
@@ -347,5 +823,19 @@ func (h *Handler) Summary(ctx context.Context) error {
 	table.AppendBulk(data)
 	table.SetAlignment(tablewriter.ALIGN_CENTER)
 	table.Render()
+
+	if len(sd.Sources) == 0 {
+		return nil
+	}
+	fmt.Println()
+	table = tablewriter.NewWriter(os.Stdout)
+	table.SetAutoFormatHeaders(false)
+	table.SetHeader([]string{"Source", "Proxies", "Unique", "UniqueRatio"})
+	table.SetBorder(false)
+	for _, s := range sd.Sources {
+		table.Append([]string{s.Name, strconv.Itoa(s.Total), strconv.Itoa(s.Unique), percent(s.Unique, s.Total)})
+	}
+	table.SetAlignment(tablewriter.ALIGN_CENTER)
+	table.Render()
 	return nil
 }
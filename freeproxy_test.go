@@ -0,0 +1,174 @@
+package freeproxy
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xwjdsh/freeproxy/config"
+	"github.com/xwjdsh/freeproxy/parser"
+	"github.com/xwjdsh/freeproxy/proxy"
+	"github.com/xwjdsh/freeproxy/storage"
+	"github.com/xwjdsh/freeproxy/validator"
+)
+
+// mockValidator decides the pre-check and validation results by the proxy servers, no network is used.
+type mockValidator struct {
+	*validator.Validator
+
+	mutex       sync.Mutex
+	unreachable map[string]bool
+	invalid     map[string]bool
+	validated   []string
+}
+
+func (v *mockValidator) CheckNetwork(ctx context.Context) error { return nil }
+func (v *mockValidator) PreCheckEnabled() bool                  { return true }
+func (v *mockValidator) PreCheckWorker() int                    { return 2 }
+
+func (v *mockValidator) GetCountryInfo(ctx context.Context, server string) (string, string, error) {
+	return "US", "United States", nil
+}
+
+func (v *mockValidator) PreCheck(ctx context.Context, p proxy.Proxy) error {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if v.unreachable[p.GetBase().Server] {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func (v *mockValidator) Validate(ctx context.Context, p proxy.Proxy) error {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	server := p.GetBase().Server
+	v.validated = append(v.validated, server)
+	if v.invalid[server] {
+		return errors.New("timeout")
+	}
+	p.GetBase().Delay = 100
+	return nil
+}
+
+// takeValidated returns the sorted servers validated since the last call.
+func (v *mockValidator) takeValidated() []string {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	servers := v.validated
+	v.validated = nil
+	sort.Strings(servers)
+	return servers
+}
+
+func TestFetchAndTidy(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	servers := []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5"}
+	links := []string{}
+	for _, server := range servers {
+		p, err := proxy.NewProxyByConfigMap(map[string]interface{}{
+			"type": "ss", "server": server, "port": 8388, "cipher": "aes-128-gcm", "password": "x",
+		})
+		require.Nil(t, err)
+		links = append(links, p.GetBase().Link)
+	}
+	// the vless proxy can not be validated, it is stored without the pre-check and the validation
+	vless, err := proxy.NewProxyByConfigMap(map[string]interface{}{
+		"type": "vless", "server": "10.0.0.6", "port": 443, "uuid": "b831381d-6324-4d53-ad4f-8cda48b30811", "tls": true,
+	})
+	require.Nil(t, err)
+	links = append(links, vless.GetBase().Link)
+	fp := filepath.Join(dir, "links.txt")
+	require.Nil(t, ioutil.WriteFile(fp, []byte(strings.Join(links, "\n")), 0644))
+
+	cfg := config.DefaultConfig()
+	cfg.App.Fetch.Worker = 2
+	cfg.App.Tidy.Worker = 2
+	cfg.App.Tidy.MaxConsecutiveFailures = 1
+	cfg.App.Tidy.Sentinel = nil
+	cfg.Parser.Executors = []*config.ParserExecutor{{Name: "local", Enable: true, FilePath: fp, Timeout: time.Minute}}
+	cfg.Parser.Discovery = nil
+	cfg.Storage.DSN = filepath.Join(dir, "db")
+
+	s, err := storage.Init(cfg.Storage)
+	require.Nil(t, err)
+	p, err := parser.Init(cfg.Parser, nil)
+	require.Nil(t, err)
+	rv, err := validator.New(&config.ValidatorConfig{})
+	require.Nil(t, err)
+	v := &mockValidator{
+		Validator:   rv,
+		unreachable: map[string]bool{"10.0.0.3": true, "10.0.0.4": true, "10.0.0.6": true},
+		invalid:     map[string]bool{"10.0.0.2": true},
+	}
+	h := &Handler{cfg: cfg.App, parser: p, validator: v, storage: s}
+
+	require.Nil(t, h.Fetch(ctx, true))
+	// the unreachable proxies never reach the validation
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.2", "10.0.0.5"}, v.takeValidated())
+
+	ss, err := s.GetSources(ctx, &storage.SourceQueryOptions{Name: "local"})
+	require.Nil(t, err)
+	require.Len(t, ss, 1)
+	src := ss[0]
+	assert.Equal(t, 6, src.Seen)
+	assert.Equal(t, 3, src.Reachable)
+	assert.Equal(t, 2, src.Unreachable)
+	assert.Equal(t, 3, src.ValidateFailed)
+	assert.Equal(t, 1, src.Unsupported)
+	assert.Equal(t, 3, src.Created)
+	assert.Empty(t, src.Error)
+
+	// the results of the removed profile are pruned by tidy
+	ps, err := s.GetProxies(ctx, &storage.QueryOptions{})
+	require.Nil(t, err)
+	var kept uint
+	for _, p := range ps {
+		if p.Server == "10.0.0.1" {
+			kept = p.ID
+		}
+	}
+	require.Nil(t, s.SaveProfileResult(ctx, &storage.ProfileResult{ProxyID: kept, Profile: "removed", Success: true}))
+
+	// the proxy which is unreachable now is removed by tidy without the validation,
+	// the unvalidated proxy is kept
+	v.mutex.Lock()
+	v.unreachable["10.0.0.5"] = true
+	v.mutex.Unlock()
+	require.Nil(t, h.Tidy(ctx, true, false))
+	assert.Equal(t, []string{"10.0.0.1"}, v.takeValidated())
+
+	m, err := s.GetProfileResults(ctx, []uint{kept})
+	require.Nil(t, err)
+	assert.Empty(t, m)
+
+	ps, err = s.GetProxies(ctx, &storage.QueryOptions{Sort: storage.SortDelay})
+	require.Nil(t, err)
+	require.Len(t, ps, 2)
+	assert.Equal(t, "10.0.0.1", ps[0].Server)
+	assert.Equal(t, "10.0.0.6", ps[1].Server)
+	assert.Equal(t, proxy.VLESS, ps[1].Type)
+	for _, p := range ps {
+		assert.Equal(t, "US", p.CountryCode)
+	}
+
+	// the proxies which can not be dialed are not used by the local proxy server and bootstrap
+	ps, err = s.GetProxies(ctx, &storage.QueryOptions{Types: validator.SupportedTypes})
+	require.Nil(t, err)
+	require.Len(t, ps, 1)
+	assert.Equal(t, "10.0.0.1", ps[0].Server)
+}
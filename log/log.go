@@ -22,5 +22,8 @@ func Init(cfg *config.LogConfig) {
 }
 
 func L() *zap.Logger {
+	if logger == nil {
+		return zap.NewNop()
+	}
 	return logger
 }
@@ -0,0 +1,28 @@
+package parser
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+)
+
+// ErrNotModified is returned by the executors whose content has not changed since the last fetch.
+var ErrNotModified = errors.New("parser: not modified")
+
+// SourceCache is what a source returned last time, used for the conditional requests.
+type SourceCache struct {
+	ETag         string
+	LastModified string
+	ContentHash  string
+}
+
+type Cache interface {
+	GetSourceCache(ctx context.Context, source string) (*SourceCache, error)
+	SaveSourceCache(ctx context.Context, source string, c *SourceCache) error
+}
+
+func contentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -3,7 +3,6 @@ package parser
 import (
 	"context"
 	"fmt"
-	"net/http"
 
 	"github.com/PuerkitoBio/goquery"
 )
@@ -16,9 +15,8 @@ func (c *cfmemExecutor) Name() string {
 	return "cfmem"
 }
 
-func (c *cfmemExecutor) Execute(ctx context.Context, linkchan chan<- *linkResp) error {
-	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "https://www.cfmem.com/search/label/free", nil)
-	res, err := http.DefaultClient.Do(req)
+func (c *cfmemExecutor) Execute(ctx context.Context, client *client, linkchan chan<- *linkResp) error {
+	res, err := client.get(ctx, "https://www.cfmem.com/search/label/free", nil)
 	if err != nil {
 		return err
 	}
@@ -33,19 +31,14 @@ func (c *cfmemExecutor) Execute(ctx context.Context, linkchan chan<- *linkResp)
 	}
 
 	if postLink, ok := doc.Find("article .entry-title a").First().Attr("href"); ok {
-		return c.parsePage(ctx, postLink, linkchan)
+		return c.parsePage(ctx, client, postLink, linkchan)
 	}
 
 	return nil
 }
 
-func (c *cfmemExecutor) parsePage(ctx context.Context, post string, linkchan chan<- *linkResp) error {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, post, nil)
-	if err != nil {
-		return err
-	}
-
-	res, err := http.DefaultClient.Do(req)
+func (c *cfmemExecutor) parsePage(ctx context.Context, client *client, post string, linkchan chan<- *linkResp) error {
+	res, err := client.get(ctx, post, nil)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,38 @@
+package parser
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+
+	"github.com/xwjdsh/freeproxy/log"
+	"github.com/xwjdsh/freeproxy/proxy"
+)
+
+type clashConfig struct {
+	Proxies []map[string]interface{} `yaml:"proxies"`
+}
+
+// parseClashConfig gets the proxies from a Clash config, unsupported entries are skipped.
+func parseClashConfig(data []byte) ([]proxy.Proxy, error) {
+	cfg := &clashConfig{}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, err
+	}
+	if len(cfg.Proxies) == 0 {
+		return nil, fmt.Errorf("parser: no proxies in clash config")
+	}
+
+	ps := make([]proxy.Proxy, 0, len(cfg.Proxies))
+	for _, m := range cfg.Proxies {
+		p, err := proxy.NewProxyByConfigMap(m)
+		if err != nil {
+			log.L().Debug("parser: invalid clash proxy", zap.Any("name", m["name"]), zap.Error(err))
+			continue
+		}
+		ps = append(ps, p)
+	}
+
+	return ps, nil
+}
@@ -0,0 +1,169 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/xwjdsh/freeproxy/config"
+	"github.com/xwjdsh/freeproxy/log"
+)
+
+// client is the HTTP client shared by the executors, every executor has a copy with its own headers.
+type client struct {
+	http      *http.Client
+	transport *http.Transport
+	cfg       *config.ParserHTTPConfig
+	limiter   *hostLimiter
+	header    http.Header
+}
+
+func newClient(cfg *config.ParserHTTPConfig) (*client, error) {
+	if cfg == nil {
+		cfg = config.DefaultConfig().Parser.HTTP
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.Proxy != "" {
+		u, err := url.Parse(cfg.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("parser: invalid http proxy: %w", err)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, fmt.Errorf("parser: unsupported http proxy scheme: %s", u.Scheme)
+		}
+		transport.Proxy = http.ProxyURL(u)
+	}
+
+	header := http.Header{}
+	if cfg.UserAgent != "" {
+		header.Set("User-Agent", cfg.UserAgent)
+	}
+	for k, v := range cfg.Headers {
+		header.Set(k, v)
+	}
+
+	return &client{
+		transport: transport,
+		http: &http.Client{
+			Transport: transport,
+			Timeout:   cfg.Timeout,
+		},
+		cfg:     cfg,
+		limiter: &hostLimiter{max: cfg.MaxConnsPerHost, hosts: map[string]chan struct{}{}},
+		header:  header,
+	}, nil
+}
+
+// withHeaders returns a copy of the client which sends the extra headers.
+func (c *client) withHeaders(headers map[string]string) *client {
+	nc := *c
+	nc.header = c.header.Clone()
+	for k, v := range headers {
+		nc.header.Set(k, v)
+	}
+	return &nc
+}
+
+// get sends a GET request, it is retried on network errors and 5xx status codes.
+// The caller must close the response body, which releases the host slot as well.
+func (c *client) get(ctx context.Context, address string, header http.Header) (*http.Response, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; ; i++ {
+		res, err := c.do(ctx, u, header)
+		if err == nil && res.StatusCode < 500 {
+			return res, nil
+		}
+		if ctx.Err() != nil || i >= c.cfg.Retry {
+			return res, err
+		}
+
+		if err != nil {
+			log.L().Debug("parser: request error, retrying", zap.String("url", address), zap.Error(err))
+		} else {
+			log.L().Debug("parser: unexpected status code, retrying", zap.String("url", address), zap.Int("code", res.StatusCode))
+			res.Body.Close()
+		}
+
+		select {
+		case <-time.After(c.cfg.RetryBackoff << i):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (c *client) do(ctx context.Context, u *url.URL, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range c.header {
+		req.Header[k] = v
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	release, err := c.limiter.acquire(ctx, u.Host)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.http.Do(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	res.Body = &releaseBody{ReadCloser: res.Body, release: release}
+	return res, nil
+}
+
+// hostLimiter limits the concurrent requests to every host, no limit if max is not positive.
+type hostLimiter struct {
+	max   int
+	mutex sync.Mutex
+	hosts map[string]chan struct{}
+}
+
+func (l *hostLimiter) acquire(ctx context.Context, host string) (func(), error) {
+	if l.max <= 0 {
+		return func() {}, nil
+	}
+
+	l.mutex.Lock()
+	ch, ok := l.hosts[host]
+	if !ok {
+		ch = make(chan struct{}, l.max)
+		l.hosts[host] = ch
+	}
+	l.mutex.Unlock()
+
+	select {
+	case ch <- struct{}{}:
+		once := sync.Once{}
+		return func() { once.Do(func() { <-ch }) }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	defer b.release()
+	return b.ReadCloser.Close()
+}
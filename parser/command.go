@@ -0,0 +1,130 @@
+package parser
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/xwjdsh/freeproxy/log"
+	"github.com/xwjdsh/freeproxy/proxy"
+)
+
+// maxStderrSize limits the kept stderr output, only its last line is reported.
+const maxStderrSize = 4096
+
+// commandExecutor runs an external program as a source, every stdout line is a link,
+// or a JSON record which is either {"link": "..."} or a Clash style proxy mapping.
+type commandExecutor struct {
+	name    string
+	command string
+	args    []string
+}
+
+func (c *commandExecutor) Name() string {
+	return c.name
+}
+
+func (c *commandExecutor) Execute(ctx context.Context, _ *client, linkChan chan<- *linkResp) error {
+	cmd := exec.CommandContext(ctx, c.command, c.args...)
+	stderr := &tailWriter{max: maxStderrSize}
+	cmd.Stderr = stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		lr := &linkResp{Source: c.name, Link: line}
+		if strings.HasPrefix(line, "{") {
+			lr.Link, lr.Proxy, err = parseRecord(line)
+			if err != nil {
+				log.L().Debug("parser: invalid command record", zap.String("name", c.name), zap.Error(err))
+				continue
+			}
+		}
+		select {
+		case linkChan <- lr:
+		case <-ctx.Done():
+			// nobody receives the links anymore, the command is stopped before it is reaped
+			cmd.Process.Kill()
+			cmd.Wait()
+			return ctx.Err()
+		}
+	}
+	scanErr := scanner.Err()
+	if scanErr != nil {
+		// the rest of the output is discarded, otherwise the command blocks on the full pipe
+		io.Copy(ioutil.Discard, stdout)
+	}
+
+	if err := cmd.Wait(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		msg := strings.TrimSpace(stderr.String())
+		if i := strings.LastIndex(msg, "\n"); i >= 0 {
+			msg = msg[i+1:]
+		}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			if msg == "" {
+				return fmt.Errorf("command exited with code %d", exitErr.ExitCode())
+			}
+			return fmt.Errorf("command exited with code %d: %s", exitErr.ExitCode(), msg)
+		}
+		return err
+	}
+
+	return scanErr
+}
+
+// tailWriter keeps the last max bytes written to it.
+type tailWriter struct {
+	max int
+	buf []byte
+}
+
+func (w *tailWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	if n := len(w.buf) - w.max; n > 0 {
+		w.buf = append(w.buf[:0], w.buf[n:]...)
+	}
+	return len(p), nil
+}
+
+func (w *tailWriter) String() string {
+	return string(w.buf)
+}
+
+func parseRecord(line string) (string, proxy.Proxy, error) {
+	m := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(line), &m); err != nil {
+		return "", nil, err
+	}
+
+	if link, ok := m["link"].(string); ok {
+		return link, nil, nil
+	}
+
+	p, err := proxy.NewProxyByConfigMap(m)
+	return "", p, err
+}
@@ -0,0 +1,125 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/xwjdsh/freeproxy/proxy"
+)
+
+const (
+	formatAuto    = "auto"
+	formatBase64  = "base64"
+	formatLinks   = "links"
+	formatClash   = "clash"
+	formatSingbox = "singbox"
+)
+
+func formatValid(format string) bool {
+	switch format {
+	case "", formatAuto, formatBase64, formatLinks, formatClash, formatSingbox:
+		return true
+	}
+	return false
+}
+
+// content is the decoded body of a subscription.
+type content struct {
+	Format  string
+	Links   []string
+	Proxies []proxy.Proxy
+}
+
+// decodeContent decodes the body of a subscription, the format is detected when it is empty or "auto".
+func decodeContent(data []byte, format string) (*content, error) {
+	if format == "" || format == formatAuto {
+		format = detectFormat(data)
+		if format == "" {
+			return nil, fmt.Errorf("parser: unknown content format")
+		}
+	}
+
+	c := &content{Format: format}
+	switch format {
+	case formatLinks:
+		c.Links = splitLines(data)
+	case formatBase64:
+		decoded, err := proxy.Base64Decode(strings.Join(strings.Fields(string(data)), ""))
+		if err != nil {
+			return nil, err
+		}
+		// some feeds encode the whole Clash or sing-box config
+		inner := detectFormat([]byte(decoded))
+		if inner == "" || inner == formatBase64 {
+			inner = formatLinks
+		}
+		ic, err := decodeContent([]byte(decoded), inner)
+		if err != nil {
+			return nil, err
+		}
+		c.Links, c.Proxies = ic.Links, ic.Proxies
+	case formatClash:
+		ps, err := parseClashConfig(data)
+		if err != nil {
+			return nil, err
+		}
+		c.Proxies = ps
+	case formatSingbox:
+		ps, err := parseSingboxConfig(data)
+		if err != nil {
+			return nil, err
+		}
+		c.Proxies = ps
+	default:
+		return nil, fmt.Errorf("parser: invalid content format: %s", format)
+	}
+
+	return c, nil
+}
+
+// detectFormat sniffs the body format, it returns an empty string if nothing matches.
+func detectFormat(data []byte) string {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return ""
+	}
+
+	if trimmed[0] == '{' {
+		var v struct {
+			Outbounds []json.RawMessage `json:"outbounds"`
+		}
+		if json.Unmarshal(trimmed, &v) == nil && len(v.Outbounds) > 0 {
+			return formatSingbox
+		}
+	}
+
+	for _, line := range splitLines(trimmed) {
+		if proxy.LinkValid(line) {
+			return formatLinks
+		}
+		if strings.HasPrefix(line, "proxies:") {
+			return formatClash
+		}
+	}
+
+	if _, err := proxy.Base64Decode(strings.Join(strings.Fields(string(trimmed)), "")); err == nil {
+		return formatBase64
+	}
+
+	return ""
+}
+
+func splitLines(data []byte) []string {
+	lines := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,168 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/xwjdsh/freeproxy/config"
+	"github.com/xwjdsh/freeproxy/log"
+	"github.com/xwjdsh/freeproxy/proxy"
+)
+
+var urlRegexp = regexp.MustCompile(`https?://[^\s"'<>]+`)
+
+// execute runs the executor and returns its result,
+// the subscription URLs in its output are fetched if discovery is enabled.
+func (h *Handler) execute(ctx context.Context, e *executorAndConfig, linkChan chan<- *linkResp) (*executeResult, error) {
+	if h.discovery == nil {
+		return run(ctx, e, linkChan)
+	}
+
+	ch := make(chan *linkResp)
+	var res *executeResult
+	errCh := make(chan error, 1)
+	go func() {
+		defer close(ch)
+		var err error
+		res, err = run(ctx, e, ch)
+		errCh <- err
+	}()
+
+	d := &discoverer{
+		client:  e.client,
+		cfg:     h.cfg.Discovery,
+		pattern: h.discovery,
+		visited: map[string]bool{},
+	}
+	// the links are still drained after the cancellation, so the executor is not blocked
+	for lr := range ch {
+		d.forward(ctx, lr, linkChan, 0)
+	}
+
+	err := <-errCh
+	return res, err
+}
+
+func run(ctx context.Context, e *executorAndConfig, linkChan chan<- *linkResp) (*executeResult, error) {
+	if re, ok := e.Executor.(resultExecutor); ok {
+		return re.ExecuteResult(ctx, e.client, linkChan)
+	}
+	return nil, e.Execute(ctx, e.client, linkChan)
+}
+
+type discoverer struct {
+	client  *client
+	cfg     *config.ParserDiscoveryConfig
+	pattern *regexp.Regexp
+	visited map[string]bool
+	fetches int
+}
+
+// forward sends the link to out, or fetches the subscriptions in it.
+// The proxies of the subscriptions keep the source of the link.
+func (d *discoverer) forward(ctx context.Context, lr *linkResp, out chan<- *linkResp, depth int) error {
+	send := func(lr *linkResp) error {
+		select {
+		case out <- lr:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if lr.Proxy != nil || proxy.LinkValid(lr.Link) {
+		return send(lr)
+	}
+
+	subs := d.subscriptions(lr.Link)
+	if len(subs) == 0 {
+		return send(lr)
+	}
+
+	for _, sub := range subs {
+		if depth >= d.cfg.MaxDepth || d.fetches >= d.cfg.MaxFetches || d.visited[sub] {
+			continue
+		}
+		d.visited[sub] = true
+		d.fetches++
+
+		ct, err := d.fetch(ctx, sub)
+		if err != nil {
+			log.L().Debug("parser: fetch subscription error", zap.String("source", lr.Source), zap.String("url", sub), zap.Error(err))
+			continue
+		}
+		log.L().Debug("parser: subscription discovered", zap.String("source", lr.Source), zap.String("url", sub), zap.String("format", ct.Format))
+
+		for _, link := range ct.Links {
+			if err := d.forward(ctx, &linkResp{Source: lr.Source, Link: link}, out, depth+1); err != nil {
+				return err
+			}
+		}
+		for _, p := range ct.Proxies {
+			if err := send(&linkResp{Source: lr.Source, Proxy: p}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// subscriptions returns the URLs in text which look like subscriptions and are allowed by the domain limits.
+func (d *discoverer) subscriptions(text string) []string {
+	subs := []string{}
+	for _, s := range urlRegexp.FindAllString(text, -1) {
+		u, err := url.Parse(s)
+		if err != nil || !d.pattern.MatchString(u.Host+u.RequestURI()) {
+			continue
+		}
+		if d.domainAllowed(u.Hostname()) {
+			subs = append(subs, s)
+		}
+	}
+	return subs
+}
+
+func (d *discoverer) domainAllowed(host string) bool {
+	match := func(domains []string) bool {
+		for _, domain := range domains {
+			if host == domain || strings.HasSuffix(host, "."+domain) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if match(d.cfg.DeniedDomains) {
+		return false
+	}
+	return len(d.cfg.AllowedDomains) == 0 || match(d.cfg.AllowedDomains)
+}
+
+func (d *discoverer) fetch(ctx context.Context, sub string) (*content, error) {
+	res, err := d.client.get(ctx, sub, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("unexpected status code: %d", res.StatusCode)
+	}
+
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// unknown contents are scanned line by line, they may link to other subscriptions
+	format := detectFormat(data)
+	if format == "" {
+		format = formatLinks
+	}
+	return decodeContent(data, format)
+}
@@ -5,7 +5,6 @@ import (
 	"encoding/xml"
 	"fmt"
 	"io/ioutil"
-	"net/http"
 	"strings"
 
 	"github.com/PuerkitoBio/goquery"
@@ -70,10 +69,8 @@ func (c *feedburnerExecutor) Name() string {
 	return "feedburner"
 }
 
-func (c *feedburnerExecutor) Execute(ctx context.Context, linkChan chan<- *linkResp) error {
-	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "https://feeds.feedburner.com/mattkaydiary", nil)
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/97.0.4692.99 Safari/537.36")
-	res, err := http.DefaultClient.Do(req)
+func (c *feedburnerExecutor) Execute(ctx context.Context, client *client, linkChan chan<- *linkResp) error {
+	res, err := client.get(ctx, "https://feeds.feedburner.com/mattkaydiary", nil)
 	if err != nil {
 		return err
 	}
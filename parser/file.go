@@ -1,52 +1,114 @@
 package parser
 
 import (
-	"bufio"
-	"bytes"
 	"context"
-	"encoding/base64"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/xwjdsh/freeproxy/log"
 )
 
 type generalFileExecutor struct {
 	address string
 	name    string
+	// format is the configured body format, it is detected if empty
+	format string
+	// cache enables the conditional requests if not nil, the new cache is returned instead of saved
+	cache Cache
 }
 
 func (c *generalFileExecutor) Name() string {
 	return c.name
 }
 
-func (c *generalFileExecutor) Execute(ctx context.Context, linkChan chan<- *linkResp) error {
-	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, c.address, nil)
-	res, err := http.DefaultClient.Do(req)
+func (c *generalFileExecutor) Execute(ctx context.Context, client *client, linkChan chan<- *linkResp) error {
+	_, err := c.ExecuteResult(ctx, client, linkChan)
+	return err
+}
+
+func (c *generalFileExecutor) ExecuteResult(ctx context.Context, client *client, linkChan chan<- *linkResp) (*executeResult, error) {
+	header := http.Header{}
+
+	var cached *SourceCache
+	if c.cache != nil {
+		var err error
+		cached, err = c.cache.GetSourceCache(ctx, c.name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cached != nil {
+		if cached.ETag != "" {
+			header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	res, err := client.get(ctx, c.address, header)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotModified && cached != nil {
+		return nil, ErrNotModified
+	}
 	if res.StatusCode != 200 {
-		return fmt.Errorf("unexpected status code: %d", res.StatusCode)
+		return nil, fmt.Errorf("unexpected status code: %d", res.StatusCode)
 	}
 
 	data, err := ioutil.ReadAll(res.Body)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	respData, err := base64.StdEncoding.DecodeString(string(data))
+
+	// many servers ignore the conditional headers, compare the content as well
+	newCache := &SourceCache{
+		ETag:         res.Header.Get("ETag"),
+		LastModified: res.Header.Get("Last-Modified"),
+		ContentHash:  contentHash(data),
+	}
+	if cached != nil && cached.ContentHash == newCache.ContentHash {
+		return &executeResult{Cache: newCache}, ErrNotModified
+	}
+
+	ct, err := decodeContent(data, c.format)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	log.L().Debug("parser: file content decoded", zap.String("name", c.name), zap.String("format", ct.Format))
 
-	scanner := bufio.NewScanner(bytes.NewReader(respData))
-	for scanner.Scan() {
-		linkChan <- &linkResp{
-			Source: c.name,
-			Link:   scanner.Text(),
+	if err := sendContent(ctx, c.name, ct, linkChan); err != nil {
+		return nil, err
+	}
+	return &executeResult{Format: ct.Format, Cache: newCache}, nil
+}
+
+// sendContent sends the links and proxies of the content, it stops when ctx is done.
+func sendContent(ctx context.Context, source string, ct *content, linkChan chan<- *linkResp) error {
+	send := func(lr *linkResp) error {
+		select {
+		case linkChan <- lr:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
 		}
 	}
 
-	return scanner.Err()
+	for _, link := range ct.Links {
+		if err := send(&linkResp{Source: source, Link: link}); err != nil {
+			return err
+		}
+	}
+	for _, p := range ct.Proxies {
+		if err := send(&linkResp{Source: source, Proxy: p}); err != nil {
+			return err
+		}
+	}
+	return nil
 }
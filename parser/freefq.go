@@ -4,7 +4,6 @@ import (
 	"bufio"
 	"context"
 	"fmt"
-	"net/http"
 	"regexp"
 	"strings"
 
@@ -37,9 +36,8 @@ func (c *baseFreefqExecutor) Name() string {
 	return c.name
 }
 
-func (c *baseFreefqExecutor) Execute(ctx context.Context, linkChan chan<- *linkResp) error {
-	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, c.address, nil)
-	res, err := http.DefaultClient.Do(req)
+func (c *baseFreefqExecutor) Execute(ctx context.Context, client *client, linkChan chan<- *linkResp) error {
+	res, err := client.get(ctx, c.address, nil)
 	if err != nil {
 		return err
 	}
@@ -61,17 +59,16 @@ func (c *baseFreefqExecutor) Execute(ctx context.Context, linkChan chan<- *linkR
 
 	host := "https://freefq.com"
 	pageLink = host + pageLink
-	fileLink, err := c.getFileLinkByPageLink(ctx, pageLink)
+	fileLink, err := c.getFileLinkByPageLink(ctx, client, pageLink)
 	if err != nil {
 		return err
 	}
 
-	return c.fetchFile(ctx, fileLink, linkChan)
+	return c.fetchFile(ctx, client, fileLink, linkChan)
 }
 
-func (c *baseFreefqExecutor) fetchFile(ctx context.Context, fileLink string, linkChan chan<- *linkResp) error {
-	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, fileLink, nil)
-	res, err := http.DefaultClient.Do(req)
+func (c *baseFreefqExecutor) fetchFile(ctx context.Context, client *client, fileLink string, linkChan chan<- *linkResp) error {
+	res, err := client.get(ctx, fileLink, nil)
 	if err != nil {
 		return err
 	}
@@ -120,9 +117,8 @@ func getV2raylink(line string) (string, bool) {
 	return "vmess://" + result[1], true
 }
 
-func (c *baseFreefqExecutor) getFileLinkByPageLink(ctx context.Context, pageLink string) (string, error) {
-	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, pageLink, nil)
-	res, err := http.DefaultClient.Do(req)
+func (c *baseFreefqExecutor) getFileLinkByPageLink(ctx context.Context, client *client, pageLink string) (string, error) {
+	res, err := client.get(ctx, pageLink, nil)
 	if err != nil {
 		return "", err
 	}
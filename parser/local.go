@@ -0,0 +1,146 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/xwjdsh/freeproxy/log"
+)
+
+// stdinPath is the FilePath which reads links from the standard input.
+const stdinPath = "-"
+
+type localFileExecutor struct {
+	name string
+	// pattern is a file path, a directory or a glob pattern
+	pattern string
+	format  string
+	stdin   io.Reader
+}
+
+func (c *localFileExecutor) Name() string {
+	return c.name
+}
+
+func (c *localFileExecutor) Execute(ctx context.Context, client *client, linkChan chan<- *linkResp) error {
+	_, err := c.ExecuteResult(ctx, client, linkChan)
+	return err
+}
+
+// ExecuteResult reports the detected formats of the files joined by ",".
+func (c *localFileExecutor) ExecuteResult(ctx context.Context, _ *client, linkChan chan<- *linkResp) (*executeResult, error) {
+	if c.pattern == stdinPath {
+		data, err := ioutil.ReadAll(c.stdin)
+		if err != nil {
+			return nil, err
+		}
+		format, err := c.send(ctx, data, linkChan)
+		if err != nil {
+			return nil, err
+		}
+		return &executeResult{Format: format}, nil
+	}
+
+	files, err := c.files()
+	if err != nil {
+		return nil, err
+	}
+
+	formats := []string{}
+	var lastErr error
+	for _, fp := range files {
+		format, err := c.sendFile(ctx, fp, linkChan)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			// a bad file does not abort the others, the links of the previous files are sent already
+			log.L().Warn("parser: skip local file", zap.String("name", c.name), zap.String("file", fp), zap.Error(err))
+			lastErr = fmt.Errorf("%s: %w", fp, err)
+			continue
+		}
+		formats = appendUnique(formats, format)
+	}
+	if len(formats) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+
+	return &executeResult{Format: strings.Join(formats, ",")}, nil
+}
+
+func (c *localFileExecutor) sendFile(ctx context.Context, fp string, linkChan chan<- *linkResp) (string, error) {
+	data, err := ioutil.ReadFile(fp)
+	if err != nil {
+		return "", err
+	}
+	return c.send(ctx, data, linkChan)
+}
+
+func (c *localFileExecutor) send(ctx context.Context, data []byte, linkChan chan<- *linkResp) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	ct, err := decodeContent(data, c.format)
+	if err != nil {
+		return "", err
+	}
+
+	if err := sendContent(ctx, c.name, ct, linkChan); err != nil {
+		return "", err
+	}
+	return ct.Format, nil
+}
+
+// files expands the pattern, the regular files of matched directories are included.
+func (c *localFileExecutor) files() ([]string, error) {
+	matches, err := filepath.Glob(c.pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("parser: no files match: %s", c.pattern)
+	}
+
+	files := []string{}
+	for _, m := range matches {
+		fi, err := os.Stat(m)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			files = append(files, m)
+			continue
+		}
+
+		entries, err := ioutil.ReadDir(m)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if e.Mode().IsRegular() && !strings.HasPrefix(e.Name(), ".") {
+				files = append(files, filepath.Join(m, e.Name()))
+			}
+		}
+	}
+	sort.Strings(files)
+
+	return files, nil
+}
+
+func appendUnique(ss []string, s string) []string {
+	for _, v := range ss {
+		if v == s {
+			return ss
+		}
+	}
+	return append(ss, s)
+}
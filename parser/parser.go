@@ -2,8 +2,13 @@ package parser
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
+	"os"
+	"regexp"
 	"sync"
+	"time"
 
 	"go.uber.org/zap"
 
@@ -15,28 +20,68 @@ import (
 type Result struct {
 	Source     string
 	SourceDone bool
-	Proxy      proxy.Proxy
-	Err        error
+	// Format is the detected content format of the source, only set when SourceDone
+	Format string
+	// NotModified means the source content has not changed since the last fetch, only set when SourceDone
+	NotModified bool
+	// Duration is the time the source took, only set when SourceDone
+	Duration time.Duration
+	// Cache is the new source cache, only set when SourceDone, see Handler.SaveSourceCache
+	Cache *SourceCache
+	Proxy proxy.Proxy
+	// Err is the source error when SourceDone, otherwise the link parse error and Proxy is nil
+	Err error
 }
 
 type Executor interface {
-	Execute(ctx context.Context, linkchan chan<- *linkResp) error
+	Execute(ctx context.Context, c *client, linkchan chan<- *linkResp) error
 	Name() string
 }
 
+// executeResult is what an execution reports besides the links.
+type executeResult struct {
+	// Format is the detected content format
+	Format string
+	// Cache is the new source cache, it is saved after the proxies of the source are handled
+	Cache *SourceCache
+}
+
+// resultExecutor is implemented by the executors which report the execution result,
+// the result may be returned with ErrNotModified.
+type resultExecutor interface {
+	ExecuteResult(ctx context.Context, c *client, linkchan chan<- *linkResp) (*executeResult, error)
+}
+
+// DialFunc dials a network connection, it is used to replace the default dialer of the HTTP client.
+type DialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// SetDialer routes all the parser HTTP traffic through dial, it must be called before Parse.
+func (h *Handler) SetDialer(dial DialFunc) {
+	h.client.transport.DialContext = dial
+}
+
 type executorAndConfig struct {
 	Executor
-	cfg *config.ParserExecutor
+	cfg    *config.ParserExecutor
+	client *client
 }
 
 type Handler struct {
+	// cache is nil if the conditional fetch is disabled
+	cache     Cache
 	executors map[string]*executorAndConfig
 	cfg       *config.ParserConfig
+	discovery *regexp.Regexp
+	client    *client
 }
 
 type linkResp struct {
 	Source string
 	Link   string
+	// Proxy is set by the executors which get proxies from structured configs instead of links.
+	Proxy proxy.Proxy
+	// done is the SourceDone result, it is sent after the links of the source to keep the order
+	done *Result
 }
 
 var executorsMap = map[string]Executor{}
@@ -49,19 +94,55 @@ func init() {
 	}
 }
 
-func Init(cfg *config.ParserConfig) (*Handler, error) {
+// Init creates the parser handler, the conditional requests are disabled if cache is nil.
+func Init(cfg *config.ParserConfig, cache Cache) (*Handler, error) {
+	if !cfg.ConditionalFetch {
+		cache = nil
+	}
+	c, err := newClient(cfg.HTTP)
+	if err != nil {
+		return nil, err
+	}
+
 	h := &Handler{
+		cache:     cache,
 		cfg:       cfg,
 		executors: map[string]*executorAndConfig{},
+		client:    c,
+	}
+	if d := cfg.Discovery; d != nil && d.Enable {
+		h.discovery, err = regexp.Compile(d.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("parser: invalid discovery pattern: %w", err)
+		}
+	}
+	// the caches are still saved when forced, the discovered subscriptions may change while the page does not
+	readCache := cache
+	if cfg.Force || h.discovery != nil {
+		readCache = nil
 	}
 	for _, e := range cfg.Executors {
 		if !e.Enable {
 			continue
 		}
 
+		if !formatValid(e.Format) {
+			return nil, fmt.Errorf("parser: invalid executor format: %s", e.Format)
+		}
+
 		var executor Executor
-		if e.FileURL != "" {
-			executor = &generalFileExecutor{name: e.Name, address: e.FileURL}
+		if e.Command != "" {
+			executor = &commandExecutor{name: e.Name, command: e.Command, args: e.Args}
+		} else if e.Scraper != nil {
+			var err error
+			executor, err = newScraperExecutor(e.Name, e.Scraper)
+			if err != nil {
+				return nil, err
+			}
+		} else if fp := e.LocalPath(); fp != "" {
+			executor = &localFileExecutor{name: e.Name, pattern: fp, format: e.Format, stdin: os.Stdin}
+		} else if e.FileURL != "" {
+			executor = &generalFileExecutor{name: e.Name, address: e.FileURL, format: e.Format, cache: readCache}
 		} else {
 			if h.executors[e.Name] != nil {
 				return nil, fmt.Errorf("parser: registered executor: %s", e.Name)
@@ -77,19 +158,35 @@ func Init(cfg *config.ParserConfig) (*Handler, error) {
 		h.executors[e.Name] = &executorAndConfig{
 			Executor: executor,
 			cfg:      e,
+			client:   c.withHeaders(e.Headers),
 		}
 	}
 
 	return h, nil
 }
 
-func (h *Handler) Parse(ctx context.Context, ch chan<- *Result) {
+// SaveSourceCache saves the source cache of the SourceDone result. It must be called after the proxies
+// of the source are handled, so an aborted run does not mark the source as not modified.
+func (h *Handler) SaveSourceCache(ctx context.Context, r *Result) error {
+	if h.cache == nil || r.Cache == nil {
+		return nil
+	}
+	return h.cache.SaveSourceCache(ctx, r.Source, r.Cache)
+}
+
+// Parse runs all the executors except the skipped ones and sends the results to ch.
+func (h *Handler) Parse(ctx context.Context, ch chan<- *Result, skip map[string]bool) {
 	wg := sync.WaitGroup{}
-	wg.Add(len(h.executors))
 	linkChan := make(chan *linkResp)
+	parent := ctx
 
 	for _, e := range h.executors {
+		if skip[e.Name()] {
+			continue
+		}
+
 		e := e
+		wg.Add(1)
 		go func() {
 			ctx, cancel := context.WithTimeout(ctx, e.cfg.Timeout)
 			defer func() {
@@ -99,12 +196,26 @@ func (h *Handler) Parse(ctx context.Context, ch chan<- *Result) {
 			}()
 
 			log.L().Debug("parser: executor start", zap.String("name", e.Name()))
+			start := time.Now()
 			r := &Result{Source: e.Name(), SourceDone: true}
-			r.Err = e.Execute(ctx, linkChan)
+			res, err := h.execute(ctx, e, linkChan)
+			if res != nil {
+				r.Format, r.Cache = res.Format, res.Cache
+			}
+			r.Err = err
+			r.Duration = time.Since(start)
+			if errors.Is(r.Err, ErrNotModified) {
+				r.Err = nil
+				r.NotModified = true
+			}
 			if r.Err != nil {
 				log.L().Debug("parser: executor error", zap.Error(r.Err))
 			}
-			ch <- r
+			// the links of the source are all received by the loop below, the result follows them
+			select {
+			case linkChan <- &linkResp{Source: r.Source, done: r}:
+			case <-parent.Done():
+			}
 		}()
 	}
 
@@ -119,9 +230,18 @@ func (h *Handler) Parse(ctx context.Context, ch chan<- *Result) {
 			if !ok {
 				return
 			}
-			r := &Result{Source: lr.Source}
-			r.Proxy, r.Err = proxy.NewProxyByLink(lr.Link)
+			if lr.done != nil {
+				ch <- lr.done
+				continue
+			}
+
+			r := &Result{Source: lr.Source, Proxy: lr.Proxy}
+			if r.Proxy == nil {
+				r.Proxy, r.Err = proxy.NewProxyByLink(lr.Link)
+			}
 			if r.Err != nil {
+				log.L().Debug("parser: invalid link", zap.String("source", lr.Source), zap.Error(r.Err))
+				ch <- r
 				continue
 			}
 
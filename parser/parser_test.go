@@ -1,11 +1,24 @@
 package parser
 
 import (
+	"bufio"
 	"context"
+	"encoding/base64"
 	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xwjdsh/freeproxy/config"
 )
 
 func TestCfmem(t *testing.T) {
@@ -15,7 +28,7 @@ func TestCfmem(t *testing.T) {
 			<-linkChan
 		}
 	}()
-	err := cfmemInstance.Execute(context.Background(), linkChan)
+	err := cfmemInstance.Execute(context.Background(), testClient(t), linkChan)
 	assert.Nil(t, err)
 }
 
@@ -26,6 +39,549 @@ func TestFreefq(t *testing.T) {
 			fmt.Println(<-linkChan)
 		}
 	}()
-	err := freefqInstance.Execute(context.Background(), linkChan)
+	err := freefqSSInstance.Execute(context.Background(), testClient(t), linkChan)
 	assert.Nil(t, err)
 }
+
+func TestGeneralFileExecutorClash(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`
+proxies:
+  - {name: ss, type: ss, server: 1.2.3.4, port: 8388, cipher: aes-256-gcm, password: pass}
+  - name: vmess
+    type: vmess
+    server: example.com
+    port: "443"
+    uuid: b831381d-6324-4d53-ad4f-8cda48b30811
+    alterId: 0
+    cipher: auto
+    tls: true
+    network: ws
+    ws-opts:
+      path: /ws
+      headers:
+        Host: cdn.example.com
+  - {name: ssr, type: ssr, server: 1.2.3.5, port: 443, cipher: chacha20-ietf, password: pass, obfs: plain, protocol: auth_aes128_md5, protocol-param: "1:abc"}
+  - {name: hy2, type: hysteria2, server: 1.2.3.6, port: 443, password: pass, up: 30, down: 100}
+  - {name: socks, type: socks5, server: 1.2.3.7, port: 1080}
+`))
+	}))
+	defer s.Close()
+
+	e := &generalFileExecutor{name: "clash", address: s.URL, format: formatClash}
+	linkChan := make(chan *linkResp, 10)
+	require.Nil(t, e.Execute(context.Background(), testClient(t), linkChan))
+	close(linkChan)
+
+	ms := map[string]map[string]interface{}{}
+	for lr := range linkChan {
+		require.NotNil(t, lr.Proxy)
+		assert.Equal(t, "clash", lr.Source)
+		assert.NotEmpty(t, lr.Proxy.GetBase().Link)
+
+		m, err := lr.Proxy.ConfigMap()
+		require.Nil(t, err)
+		ms[m["name"].(string)] = m
+	}
+
+	require.Len(t, ms, 4)
+	assert.Equal(t, "aes-256-gcm", ms["ss"]["cipher"])
+	assert.Equal(t, 443, ms["vmess"]["port"])
+	assert.Equal(t, map[string]interface{}{"path": "/ws", "headers": map[string]interface{}{"Host": "cdn.example.com"}}, ms["vmess"]["ws-opts"])
+	assert.Equal(t, "1:abc", ms["ssr"]["protocol_param"])
+	assert.Equal(t, "30 Mbps", ms["hy2"]["up"])
+}
+
+func TestDecodeContent(t *testing.T) {
+	links := "ss://YWVzLTI1Ni1nY206S2l4THZLendqZWtHMDBybQ@38.68.134.37:8080\ntrojan://password@example.com:443?sni=example.com\n"
+	clash := "proxies:\n  - {name: ss, type: ss, server: 1.2.3.4, port: 8388, cipher: aes-256-gcm, password: pass}\n"
+	singbox := `{"outbounds":[
+		{"type":"vless","tag":"vless","server":"1.2.3.4","server_port":443,"uuid":"b831381d-6324-4d53-ad4f-8cda48b30811","flow":"xtls-rprx-vision",
+			"tls":{"enabled":true,"server_name":"www.microsoft.com","utls":{"enabled":true,"fingerprint":"chrome"},"reality":{"enabled":true,"public_key":"pbk","short_id":"sid"}}},
+		{"type":"shadowsocks","tag":"ss","server":"1.2.3.5","server_port":8388,"method":"aes-128-gcm","password":"pass"},
+		{"type":"hysteria2","tag":"hy2","server":"1.2.3.6","server_port":443,"password":"pass","obfs":{"type":"salamander","password":"obfs"},"tls":{"enabled":true,"server_name":"example.com"}},
+		{"type":"direct","tag":"direct"}
+	]}`
+
+	for _, c := range []struct {
+		data    string
+		format  string
+		links   int
+		proxies int
+	}{
+		{links, formatLinks, 2, 0},
+		{base64.StdEncoding.EncodeToString([]byte(links)), formatBase64, 2, 0},
+		{base64.RawURLEncoding.EncodeToString([]byte(links)), formatBase64, 2, 0},
+		{clash, formatClash, 0, 1},
+		{base64.StdEncoding.EncodeToString([]byte(clash)), formatBase64, 0, 1},
+		{singbox, formatSingbox, 0, 3},
+	} {
+		ct, err := decodeContent([]byte(c.data), "")
+		require.Nil(t, err)
+		assert.Equal(t, c.format, ct.Format)
+		assert.Len(t, ct.Links, c.links)
+		assert.Len(t, ct.Proxies, c.proxies)
+	}
+
+	_, err := decodeContent([]byte("<html>not a subscription</html>"), "")
+	assert.NotNil(t, err)
+
+	ct, err := decodeContent([]byte(singbox), formatSingbox)
+	require.Nil(t, err)
+	m, err := ct.Proxies[0].ConfigMap()
+	require.Nil(t, err)
+	assert.Equal(t, "vless", m["type"])
+	assert.Equal(t, true, m["tls"])
+	assert.Equal(t, "chrome", m["client-fingerprint"])
+	assert.Equal(t, map[string]interface{}{"public-key": "pbk", "short-id": "sid"}, m["reality-opts"])
+}
+
+func TestLocalFileExecutor(t *testing.T) {
+	dir := t.TempDir()
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte("ss://YWVzLTI1Ni1nY206S2l4THZLendqZWtHMDBybQ@38.68.134.37:8080\ninvalid\n"), 0644))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "b.txt"), []byte(base64.StdEncoding.EncodeToString([]byte("trojan://password@example.com:443"))), 0644))
+	// the undecodable file is skipped, the others are still parsed
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "c.txt"), []byte("!!!"), 0644))
+
+	h, err := Init(&config.ParserConfig{Executors: []*config.ParserExecutor{
+		{Name: "dir", Enable: true, Timeout: time.Second, FilePath: dir},
+		{Name: "glob", Enable: true, Timeout: time.Second, FileURL: "file://" + filepath.Join(dir, "a*")},
+		{Name: "missing", Enable: true, Timeout: time.Second, FilePath: filepath.Join(dir, "missing")},
+	}}, nil)
+	require.Nil(t, err)
+
+	ch := make(chan *Result)
+	go func() {
+		h.Parse(context.Background(), ch, nil)
+		close(ch)
+	}()
+
+	proxies := map[string]int{}
+	failed := map[string]int{}
+	done := map[string]*Result{}
+	for r := range ch {
+		// SourceDone follows all the results of the source
+		assert.Nil(t, done[r.Source], r.Source)
+		if r.SourceDone {
+			done[r.Source] = r
+			continue
+		}
+		if r.Err != nil {
+			failed[r.Source]++
+			continue
+		}
+		proxies[r.Source]++
+	}
+
+	assert.Equal(t, map[string]int{"dir": 2, "glob": 1}, proxies)
+	assert.Equal(t, map[string]int{"dir": 1, "glob": 1}, failed)
+	assert.Nil(t, done["dir"].Err)
+	assert.Equal(t, "links,base64", done["dir"].Format)
+	assert.Nil(t, done["glob"].Err)
+	assert.NotNil(t, done["missing"].Err)
+
+	_, err = (&localFileExecutor{name: "bad", pattern: filepath.Join(dir, "c.txt")}).ExecuteResult(context.Background(), testClient(t), make(chan *linkResp))
+	assert.NotNil(t, err)
+
+	// nobody receives the links, the sending ends with ctx
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, sendContent(ctx, "dir", &content{Links: []string{"trojan://password@example.com:443"}}, make(chan *linkResp)))
+
+	e := &localFileExecutor{name: "stdin", pattern: stdinPath, stdin: strings.NewReader("trojan://password@example.com:443\n")}
+	linkChan := make(chan *linkResp, 1)
+	require.Nil(t, e.Execute(context.Background(), testClient(t), linkChan))
+	assert.Equal(t, "trojan://password@example.com:443", (<-linkChan).Link)
+}
+
+func TestScraperExecutor(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<article><h2 class="entry-title"><a href="/post/1">post</a></h2></article>`))
+	})
+	mux.HandleFunc("/post/1", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<fieldset><a href="../file/1">file</a></fieldset>`))
+	})
+	mux.HandleFunc("/file/1", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<pre>
+<span>trojan://password@example.com:443</span>
+<span>some text</span>
+</pre><p data="ssr://abc">ignored</p>`))
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	e, err := newScraperExecutor("scraper", &config.ParserScraper{
+		URL:          s.URL,
+		PostSelector: "article .entry-title a",
+		Follow:       []*config.ParserScraperStep{{Selector: "fieldset a"}},
+		LinkSelector: "pre span",
+	})
+	require.Nil(t, err)
+
+	linkChan := make(chan *linkResp, 10)
+	require.Nil(t, e.Execute(context.Background(), testClient(t), linkChan))
+	require.Len(t, linkChan, 2)
+	assert.Equal(t, "trojan://password@example.com:443", (<-linkChan).Link)
+	assert.Equal(t, "some text", (<-linkChan).Link)
+
+	// the second link is not received, the executor ends with ctx
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	unbuffered := make(chan *linkResp)
+	go func() {
+		<-unbuffered
+		cancel()
+	}()
+	assert.Equal(t, context.Canceled, e.Execute(ctx, testClient(t), unbuffered))
+
+	e, err = newScraperExecutor("scraper", &config.ParserScraper{
+		URL:          s.URL + "/file/1",
+		LinkSelector: "p",
+		LinkAttr:     "data",
+		LinkRegex:    `(ssr://\S+)`,
+	})
+	require.Nil(t, err)
+	require.Nil(t, e.Execute(context.Background(), testClient(t), linkChan))
+	require.Len(t, linkChan, 1)
+	assert.Equal(t, "ssr://abc", (<-linkChan).Link)
+
+	e, err = newScraperExecutor("scraper", &config.ParserScraper{
+		URL:          s.URL,
+		PostSelector: ".missing a",
+	})
+	require.Nil(t, err)
+	assert.NotNil(t, e.Execute(context.Background(), testClient(t), linkChan))
+
+	_, err = newScraperExecutor("scraper", &config.ParserScraper{URL: s.URL, LinkRegex: "("})
+	assert.NotNil(t, err)
+}
+
+func TestCommandExecutor(t *testing.T) {
+	e := &commandExecutor{name: "command", command: "sh", args: []string{"-c", `
+echo 'trojan://password@example.com:443'
+echo '{"link": "ss://YWVzLTI1Ni1nY206S2l4THZLendqZWtHMDBybQ@38.68.134.37:8080"}'
+echo '{"name": "ss", "type": "ss", "server": "1.2.3.4", "port": 8388, "cipher": "aes-256-gcm", "password": "pass"}'
+echo '{"type": "unknown"}'
+echo 'warning' >&2
+echo 'fatal error' >&2
+exit 3
+`}}
+
+	linkChan := make(chan *linkResp, 10)
+	err := e.Execute(context.Background(), testClient(t), linkChan)
+	require.NotNil(t, err)
+	assert.Equal(t, "command exited with code 3: fatal error", err.Error())
+
+	require.Len(t, linkChan, 3)
+	assert.Equal(t, "trojan://password@example.com:443", (<-linkChan).Link)
+	assert.Equal(t, "ss://YWVzLTI1Ni1nY206S2l4THZLendqZWtHMDBybQ@38.68.134.37:8080", (<-linkChan).Link)
+	lr := <-linkChan
+	require.NotNil(t, lr.Proxy)
+	assert.Equal(t, 8388, lr.Proxy.GetBase().Port)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	e = &commandExecutor{name: "command", command: "sleep", args: []string{"10"}}
+	assert.Equal(t, context.DeadlineExceeded, e.Execute(ctx, nil, linkChan))
+
+	// the output after the too long line is drained, the command is not blocked until the timeout
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	e = &commandExecutor{name: "command", command: "awk", args: []string{`BEGIN { for (i = 0; i < 400000; i++) printf "aaaaaaaaaa"; print "" }`}}
+	start := time.Now()
+	assert.Equal(t, bufio.ErrTooLong, e.Execute(ctx, nil, linkChan))
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	e = &commandExecutor{name: "command", command: "sh", args: []string{"-c", `
+head -c 100000 /dev/zero | tr '\0' a >&2
+echo >&2
+echo 'fatal error' >&2
+exit 1
+`}}
+	err = e.Execute(context.Background(), nil, linkChan)
+	require.NotNil(t, err)
+	assert.Equal(t, "command exited with code 1: fatal error", err.Error())
+
+	// the link which nobody receives does not block the executor after the cancellation
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	e = &commandExecutor{name: "command", command: "sh", args: []string{"-c", `
+echo 'trojan://password@example.com:443'
+exec sleep 10
+`}}
+	start = time.Now()
+	assert.Equal(t, context.DeadlineExceeded, e.Execute(ctx, nil, make(chan *linkResp)))
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	w := &tailWriter{max: 4}
+	w.Write([]byte("abc"))
+	w.Write([]byte("defg"))
+	assert.Equal(t, "defg", w.String())
+}
+
+func TestDiscovery(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sub", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(base64.StdEncoding.EncodeToString([]byte("trojan://password@example.com:443\ntrojan://password@example.org:443"))))
+	})
+	mux.HandleFunc("/clash.yaml", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("proxies:\n  - {name: ss, type: ss, server: 1.2.3.4, port: 8388, cipher: aes-256-gcm, password: pass}\n"))
+	})
+	mux.HandleFunc("/nested/sub", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("see http://" + r.Host + "/clash.yaml\n"))
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	dir := t.TempDir()
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte(fmt.Sprintf(`ss://YWVzLTI1Ni1nY206S2l4THZLendqZWtHMDBybQ@38.68.134.37:8080
+subscription: %[1]s/sub, backup: %[1]s/sub
+nested: %[1]s/nested/sub
+homepage: %[1]s/about
+`, s.URL)), 0644))
+
+	parse := func(d *config.ParserDiscoveryConfig) map[string]int {
+		h, err := Init(&config.ParserConfig{
+			Executors: []*config.ParserExecutor{{Name: "local", Enable: true, Timeout: time.Second, FilePath: filepath.Join(dir, "a.txt"), Format: formatLinks}},
+			Discovery: d,
+		}, nil)
+		require.Nil(t, err)
+
+		ch := make(chan *Result)
+		go func() {
+			h.Parse(context.Background(), ch, nil)
+			close(ch)
+		}()
+		m := map[string]int{}
+		for r := range ch {
+			if !r.SourceDone && r.Err == nil {
+				m[r.Source+":"+r.Proxy.GetBase().Type.String()]++
+			}
+		}
+		return m
+	}
+
+	d := config.DefaultConfig().Parser.Discovery
+	// the extra fetches are opt-in
+	assert.False(t, d.Enable)
+	assert.Equal(t, map[string]int{"local:ss": 1}, parse(d))
+
+	d.Enable = true
+	assert.Equal(t, map[string]int{"local:ss": 1, "local:trojan": 2}, parse(d))
+
+	d.MaxDepth = 2
+	assert.Equal(t, map[string]int{"local:ss": 2, "local:trojan": 2}, parse(d))
+
+	d.DeniedDomains = []string{"127.0.0.1"}
+	assert.Equal(t, map[string]int{"local:ss": 1}, parse(d))
+
+	d.DeniedDomains = nil
+	d.Enable = false
+	assert.Equal(t, map[string]int{"local:ss": 1}, parse(d))
+
+	// nobody receives the links, the forwarding ends with ctx
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	dc := &discoverer{cfg: d, visited: map[string]bool{}}
+	assert.Equal(t, context.Canceled, dc.forward(ctx, &linkResp{Source: "local", Link: "trojan://password@example.com:443"}, make(chan *linkResp), 0))
+}
+
+type memoryCache map[string]*SourceCache
+
+func (c memoryCache) GetSourceCache(ctx context.Context, source string) (*SourceCache, error) {
+	return c[source], nil
+}
+
+func (c memoryCache) SaveSourceCache(ctx context.Context, source string, sc *SourceCache) error {
+	c[source] = sc
+	return nil
+}
+
+func TestGeneralFileExecutorCache(t *testing.T) {
+	body := "trojan://password@example.com:443"
+	etag := `"v1"`
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if etag != "" && r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		if etag != "" {
+			w.Header().Set("ETag", etag)
+		}
+		w.Write([]byte(body))
+	}))
+	defer s.Close()
+
+	cache := memoryCache{}
+	newHandler := func(f func(cfg *config.ParserConfig)) *Handler {
+		cfg := &config.ParserConfig{
+			ConditionalFetch: true,
+			Executors:        []*config.ParserExecutor{{Name: "file", Enable: true, Timeout: time.Second, FileURL: s.URL}},
+		}
+		if f != nil {
+			f(cfg)
+		}
+		h, err := Init(cfg, cache)
+		require.Nil(t, err)
+		return h
+	}
+	// parse returns the SourceDone result and the proxy count
+	parse := func(h *Handler) (*Result, int) {
+		ch := make(chan *Result)
+		go func() {
+			h.Parse(context.Background(), ch, nil)
+			close(ch)
+		}()
+
+		var done *Result
+		count := 0
+		for r := range ch {
+			if r.SourceDone {
+				done = r
+			} else if r.Err == nil {
+				count++
+			}
+		}
+		return done, count
+	}
+
+	h := newHandler(nil)
+	r, count := parse(h)
+	assert.Equal(t, 1, count)
+	require.NotNil(t, r.Cache)
+	// the cache is saved after the proxies are handled, not by the parser
+	assert.Nil(t, cache["file"])
+	require.Nil(t, h.SaveSourceCache(context.Background(), r))
+	assert.Equal(t, etag, cache["file"].ETag)
+
+	r, count = parse(h)
+	assert.True(t, r.NotModified)
+	assert.Equal(t, 0, count)
+
+	// the server ignores the conditional headers, the content hash still matches
+	etag = ""
+	r, count = parse(h)
+	assert.True(t, r.NotModified)
+	assert.Equal(t, 0, count)
+	require.Nil(t, h.SaveSourceCache(context.Background(), r))
+	assert.Empty(t, cache["file"].ETag)
+
+	// the cache is ignored but still saved when forced
+	r, count = parse(newHandler(func(cfg *config.ParserConfig) { cfg.Force = true }))
+	assert.False(t, r.NotModified)
+	assert.Equal(t, 1, count)
+	assert.NotNil(t, r.Cache)
+
+	// the discovered subscriptions may change while the page does not
+	r, count = parse(newHandler(func(cfg *config.ParserConfig) {
+		cfg.Discovery = &config.ParserDiscoveryConfig{Enable: true, Pattern: "sub"}
+	}))
+	assert.False(t, r.NotModified)
+	assert.Equal(t, 1, count)
+
+	body = "trojan://password@example.org:443"
+	r, count = parse(h)
+	assert.False(t, r.NotModified)
+	assert.Equal(t, 1, count)
+
+	h = newHandler(func(cfg *config.ParserConfig) { cfg.ConditionalFetch = false })
+	r, _ = parse(h)
+	cache["file"] = nil
+	require.Nil(t, h.SaveSourceCache(context.Background(), r))
+	assert.Nil(t, cache["file"])
+}
+
+func TestExecuteResult(t *testing.T) {
+	status := http.StatusOK
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte("trojan://password@example.com:443"))
+	}))
+	defer s.Close()
+
+	e := &executorAndConfig{
+		Executor: &generalFileExecutor{name: "file", address: s.URL},
+		client:   testClient(t),
+	}
+	linkChan := make(chan *linkResp, 10)
+
+	res, err := run(context.Background(), e, linkChan)
+	require.Nil(t, err)
+	assert.Equal(t, formatLinks, res.Format)
+
+	// the format of the last successful execution is not reported by a failed one
+	status = http.StatusNotFound
+	res, err = run(context.Background(), e, linkChan)
+	assert.NotNil(t, err)
+	assert.Nil(t, res)
+}
+
+func testClient(t *testing.T) *client {
+	c, err := newClient(nil)
+	require.Nil(t, err)
+	return c
+}
+
+func TestClient(t *testing.T) {
+	var requests int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		fmt.Fprintf(w, "%s|%s", r.Header.Get("User-Agent"), r.Header.Get("X-Token"))
+	}))
+	defer s.Close()
+
+	c, err := newClient(&config.ParserHTTPConfig{
+		Retry:           2,
+		RetryBackoff:    time.Millisecond,
+		UserAgent:       "freeproxy",
+		MaxConnsPerHost: 1,
+	})
+	require.Nil(t, err)
+
+	res, err := c.withHeaders(map[string]string{"X-Token": "abc"}).get(context.Background(), s.URL, nil)
+	require.Nil(t, err)
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	require.Nil(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+	assert.Equal(t, "freeproxy|abc", string(data))
+
+	_, err = newClient(&config.ParserHTTPConfig{Proxy: "ftp://127.0.0.1:21"})
+	assert.NotNil(t, err)
+}
+
+func TestSetDialer(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("trojan://password@example.com:443"))
+	}))
+	defer s.Close()
+
+	h, err := Init(&config.ParserConfig{Executors: []*config.ParserExecutor{
+		{Name: "file", Enable: true, FileURL: "http://unreachable.invalid/sub", Timeout: 5 * time.Second},
+	}}, nil)
+	require.Nil(t, err)
+
+	dialed := 0
+	h.SetDialer(func(ctx context.Context, network, address string) (net.Conn, error) {
+		dialed++
+		return (&net.Dialer{}).DialContext(ctx, network, s.Listener.Addr().String())
+	})
+
+	resultChan := make(chan *Result, 10)
+	h.Parse(context.Background(), resultChan, nil)
+	close(resultChan)
+
+	proxies := 0
+	for r := range resultChan {
+		require.Nil(t, r.Err)
+		if r.Proxy != nil {
+			proxies++
+		}
+	}
+	assert.Equal(t, 1, dialed)
+	assert.Equal(t, 1, proxies)
+}
@@ -0,0 +1,140 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"github.com/xwjdsh/freeproxy/config"
+)
+
+type scraperExecutor struct {
+	name  string
+	cfg   *config.ParserScraper
+	steps []*config.ParserScraperStep
+	regex *regexp.Regexp
+}
+
+func newScraperExecutor(name string, cfg *config.ParserScraper) (*scraperExecutor, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("parser: scraper url is required: %s", name)
+	}
+
+	c := &scraperExecutor{name: name, cfg: cfg}
+	if cfg.PostSelector != "" {
+		c.steps = append(c.steps, &config.ParserScraperStep{Selector: cfg.PostSelector})
+	}
+	c.steps = append(c.steps, cfg.Follow...)
+
+	if cfg.LinkRegex != "" {
+		var err error
+		c.regex, err = regexp.Compile(cfg.LinkRegex)
+		if err != nil {
+			return nil, fmt.Errorf("parser: invalid scraper link regex: %s, %w", name, err)
+		}
+	}
+
+	return c, nil
+}
+
+func (c *scraperExecutor) Name() string {
+	return c.name
+}
+
+func (c *scraperExecutor) Execute(ctx context.Context, client *client, linkChan chan<- *linkResp) error {
+	page := c.cfg.URL
+	for i, step := range c.steps {
+		doc, err := getDocument(ctx, client, page)
+		if err != nil {
+			return err
+		}
+
+		attr := step.Attr
+		if attr == "" {
+			attr = "href"
+		}
+		next, ok := doc.Find(step.Selector).First().Attr(attr)
+		if !ok {
+			return fmt.Errorf("step %d: %s not found", i+1, step.Selector)
+		}
+		page, err = resolveURL(page, next)
+		if err != nil {
+			return err
+		}
+	}
+
+	doc, err := getDocument(ctx, client, page)
+	if err != nil {
+		return err
+	}
+
+	sel := doc.Selection
+	if c.cfg.LinkSelector != "" {
+		sel = doc.Find(c.cfg.LinkSelector)
+	}
+	sel.EachWithBreak(func(i int, s *goquery.Selection) bool {
+		text := s.Text()
+		if c.cfg.LinkAttr != "" {
+			text = s.AttrOr(c.cfg.LinkAttr, "")
+		}
+
+		for _, link := range c.extract(text) {
+			select {
+			case linkChan <- &linkResp{Source: c.name, Link: link}:
+			case <-ctx.Done():
+				err = ctx.Err()
+				return false
+			}
+		}
+		return true
+	})
+
+	return err
+}
+
+func (c *scraperExecutor) extract(text string) []string {
+	if c.regex == nil {
+		return splitLines([]byte(text))
+	}
+
+	links := []string{}
+	for _, m := range c.regex.FindAllStringSubmatch(text, -1) {
+		link := m[0]
+		if len(m) > 1 {
+			link = m[1]
+		}
+		if link = strings.TrimSpace(link); link != "" {
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
+func getDocument(ctx context.Context, client *client, page string) (*goquery.Document, error) {
+	res, err := client.get(ctx, page, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("unexpected status code: %d", res.StatusCode)
+	}
+
+	return goquery.NewDocumentFromReader(res.Body)
+}
+
+func resolveURL(base, ref string) (string, error) {
+	b, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	r, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return "", err
+	}
+	return b.ResolveReference(r).String(), nil
+}
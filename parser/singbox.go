@@ -0,0 +1,226 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/xwjdsh/freeproxy/log"
+	"github.com/xwjdsh/freeproxy/proxy"
+)
+
+type singboxConfig struct {
+	Outbounds []*singboxOutbound `json:"outbounds"`
+}
+
+type singboxOutbound struct {
+	Type       string `json:"type"`
+	Tag        string `json:"tag"`
+	Server     string `json:"server"`
+	ServerPort int    `json:"server_port"`
+
+	Method     string `json:"method"`
+	Password   string `json:"password"`
+	Plugin     string `json:"plugin"`
+	PluginOpts string `json:"plugin_opts"`
+
+	UUID     string `json:"uuid"`
+	AlterID  int    `json:"alter_id"`
+	Security string `json:"security"`
+	Flow     string `json:"flow"`
+
+	UpMbps   int             `json:"up_mbps"`
+	DownMbps int             `json:"down_mbps"`
+	AuthStr  string          `json:"auth_str"`
+	Obfs     json.RawMessage `json:"obfs"`
+
+	TLS *struct {
+		Enabled    bool     `json:"enabled"`
+		ServerName string   `json:"server_name"`
+		Insecure   bool     `json:"insecure"`
+		ALPN       []string `json:"alpn"`
+		UTLS       *struct {
+			Fingerprint string `json:"fingerprint"`
+		} `json:"utls"`
+		Reality *struct {
+			Enabled   bool   `json:"enabled"`
+			PublicKey string `json:"public_key"`
+			ShortID   string `json:"short_id"`
+		} `json:"reality"`
+	} `json:"tls"`
+
+	Transport *struct {
+		Type        string            `json:"type"`
+		Path        string            `json:"path"`
+		Headers     map[string]string `json:"headers"`
+		Host        []string          `json:"host"`
+		ServiceName string            `json:"service_name"`
+	} `json:"transport"`
+}
+
+// parseSingboxConfig gets the proxies from the outbounds of a sing-box config, unsupported entries are skipped.
+func parseSingboxConfig(data []byte) ([]proxy.Proxy, error) {
+	cfg := &singboxConfig{}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, err
+	}
+
+	ps := []proxy.Proxy{}
+	for _, o := range cfg.Outbounds {
+		m, err := o.configMap()
+		if err == nil {
+			var p proxy.Proxy
+			p, err = proxy.NewProxyByConfigMap(m)
+			if err == nil {
+				ps = append(ps, p)
+				continue
+			}
+		}
+		log.L().Debug("parser: invalid sing-box outbound", zap.String("tag", o.Tag), zap.Error(err))
+	}
+
+	return ps, nil
+}
+
+// configMap converts the outbound to a Clash style proxy mapping.
+func (o *singboxOutbound) configMap() (map[string]interface{}, error) {
+	m := map[string]interface{}{
+		"name":   o.Tag,
+		"server": o.Server,
+		"port":   o.ServerPort,
+	}
+
+	switch o.Type {
+	case "shadowsocks":
+		m["type"] = proxy.SS.String()
+		m["cipher"] = o.Method
+		m["password"] = o.Password
+		switch o.Plugin {
+		case "":
+		case "obfs-local":
+			opts := pluginOpts(o.PluginOpts)
+			m["plugin"] = "obfs"
+			m["plugin-opts"] = map[string]interface{}{"mode": opts["obfs"], "host": opts["obfs-host"]}
+		case "v2ray-plugin":
+			opts := pluginOpts(o.PluginOpts)
+			_, tls := opts["tls"]
+			m["plugin"] = "v2ray-plugin"
+			m["plugin-opts"] = map[string]interface{}{"mode": opts["mode"], "host": opts["host"], "tls": tls}
+		default:
+			return nil, fmt.Errorf("parser: unsupported sing-box plugin: %s", o.Plugin)
+		}
+	case "vmess":
+		m["type"] = proxy.Vmess.String()
+		m["uuid"] = o.UUID
+		m["alterId"] = o.AlterID
+		m["cipher"] = "auto"
+		if o.Security != "" {
+			m["cipher"] = o.Security
+		}
+	case "trojan":
+		m["type"] = proxy.Trojan.String()
+		m["password"] = o.Password
+		m["udp"] = true
+	case "vless":
+		m["type"] = proxy.VLESS.String()
+		m["uuid"] = o.UUID
+		m["udp"] = true
+		if o.Flow != "" {
+			m["flow"] = o.Flow
+		}
+	case "hysteria":
+		m["type"] = proxy.Hysteria.String()
+		m["up"] = o.UpMbps
+		m["down"] = o.DownMbps
+		if o.AuthStr != "" {
+			m["auth-str"] = o.AuthStr
+		}
+		var obfs string
+		if len(o.Obfs) > 0 && json.Unmarshal(o.Obfs, &obfs) == nil {
+			m["obfs"] = obfs
+		}
+	case "hysteria2":
+		m["type"] = proxy.Hysteria2.String()
+		m["password"] = o.Password
+		if o.UpMbps != 0 {
+			m["up"] = o.UpMbps
+		}
+		if o.DownMbps != 0 {
+			m["down"] = o.DownMbps
+		}
+		var obfs struct {
+			Type     string `json:"type"`
+			Password string `json:"password"`
+		}
+		if len(o.Obfs) > 0 && json.Unmarshal(o.Obfs, &obfs) == nil && obfs.Type != "" {
+			m["obfs"] = obfs.Type
+			m["obfs-password"] = obfs.Password
+		}
+	default:
+		return nil, fmt.Errorf("%w: %s", proxy.ErrUnsupportedType, o.Type)
+	}
+
+	if tls := o.TLS; tls != nil && tls.Enabled {
+		switch o.Type {
+		case "trojan", "hysteria", "hysteria2":
+			m["sni"] = tls.ServerName
+		default:
+			m["tls"] = true
+			m["servername"] = tls.ServerName
+		}
+		m["skip-cert-verify"] = tls.Insecure
+		if len(tls.ALPN) > 0 {
+			m["alpn"] = tls.ALPN
+		}
+		if tls.UTLS != nil && tls.UTLS.Fingerprint != "" {
+			m["client-fingerprint"] = tls.UTLS.Fingerprint
+		}
+		if tls.Reality != nil && tls.Reality.Enabled {
+			m["reality-opts"] = map[string]interface{}{
+				"public-key": tls.Reality.PublicKey,
+				"short-id":   tls.Reality.ShortID,
+			}
+		}
+	}
+
+	if t := o.Transport; t != nil {
+		switch t.Type {
+		case "ws":
+			m["network"] = "ws"
+			opts := map[string]interface{}{"path": t.Path}
+			if len(t.Headers) > 0 {
+				opts["headers"] = t.Headers
+			}
+			m["ws-opts"] = opts
+		case "grpc":
+			m["network"] = "grpc"
+			m["grpc-opts"] = map[string]interface{}{"grpc-service-name": t.ServiceName}
+		case "http":
+			m["network"] = "h2"
+			m["h2-opts"] = map[string]interface{}{"host": t.Host, "path": t.Path}
+		default:
+			return nil, fmt.Errorf("parser: unsupported sing-box transport: %s", t.Type)
+		}
+	}
+
+	return m, nil
+}
+
+// pluginOpts parses the SIP003 plugin options, for example "obfs=http;obfs-host=example.com".
+func pluginOpts(s string) map[string]string {
+	m := map[string]string{}
+	for _, kv := range strings.Split(s, ";") {
+		if kv = strings.TrimSpace(kv); kv == "" {
+			continue
+		}
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) == 2 {
+			m[parts[0]] = parts[1]
+		} else {
+			m[parts[0]] = ""
+		}
+	}
+	return m
+}
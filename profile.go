@@ -0,0 +1,27 @@
+package freeproxy
+
+import (
+	"context"
+
+	"github.com/xwjdsh/freeproxy/proxy"
+	"github.com/xwjdsh/freeproxy/storage"
+)
+
+// checkProfiles validates the proxy with every profile and saves the results.
+func (h *Handler) checkProfiles(ctx context.Context, id uint, p proxy.Proxy) error {
+	for _, r := range h.validator.ValidateProfiles(ctx, p) {
+		pr := &storage.ProfileResult{
+			ProxyID: id,
+			Profile: r.Profile,
+			Success: r.Success,
+			Delay:   r.Delay,
+		}
+		if r.Error != nil {
+			pr.Error = r.Error.Error()
+		}
+		if err := h.storage.SaveProfileResult(ctx, pr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
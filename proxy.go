@@ -17,6 +17,7 @@ import (
 	"github.com/google/uuid"
 
 	"github.com/xwjdsh/freeproxy/storage"
+	"github.com/xwjdsh/freeproxy/validator"
 )
 
 type ProxyOptions struct {
@@ -119,6 +120,13 @@ func (h *Handler) startProxyServer(ctx context.Context, fast bool) (*storage.Pro
 		NotCountryCodes: cfg.ProxyNotCountryCodes,
 		Count:           1,
 		Fast:            fast,
+		Sort:            cfg.Sort,
+		Healthy:         cfg.ProxyID == 0,
+		ExitCountry:     cfg.ExitCountry,
+		Profile:         cfg.Profile,
+		MinSpeed:        cfg.MinSpeed,
+		// the local proxy server runs on the clash adapter
+		Types: validator.SupportedTypes,
 	})
 	if err != nil {
 		return nil, err
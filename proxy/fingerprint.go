@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+var (
+	// transportKeys are the config keys which decide how the proxy is connected.
+	transportKeys = []string{
+		"network", "tls", "plugin", "plugin-opts", "obfs", "protocol",
+		"ws-path", "ws-opts", "http-opts", "h2-opts", "grpc-opts", "reality-opts", "flow",
+	}
+	// credentialKeys are the config keys which authenticate the client.
+	credentialKeys = []string{"cipher", "password", "uuid", "alterId", "protocol_param", "auth-str", "obfs-password"}
+)
+
+// Fingerprint returns the identity of the proxy, it is derived from the type, server, port, transport and
+// credentials, so the client options like udp, skip-cert-verify or alpn do not make a new proxy.
+func Fingerprint(p Proxy) (string, error) {
+	return identity(p, transportKeys, credentialKeys)
+}
+
+// Transport returns the identity of the proxy without the credentials,
+// the proxies with the same transport are the same node whose credentials may be rotated.
+func Transport(p Proxy) (string, error) {
+	return identity(p, transportKeys)
+}
+
+func identity(p Proxy, keyGroups ...[]string) (string, error) {
+	m, err := p.ConfigMap()
+	if err != nil {
+		return "", err
+	}
+
+	b := p.GetBase()
+	id := map[string]interface{}{"type": b.Type, "server": b.Server, "port": b.Port}
+	for _, keys := range keyGroups {
+		for _, k := range keys {
+			if v, ok := m[k]; ok && v != nil && v != "" && v != false {
+				id[k] = v
+			}
+		}
+	}
+
+	// the keys of the map are sorted by json.Marshal
+	data, err := json.Marshal(id)
+	if err != nil {
+		return "", fmt.Errorf("proxy: fingerprint error: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,246 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+type hysteriaProxy struct {
+	*Base
+	AuthStr        string   `json:"auth-str,omitempty"`
+	Obfs           string   `json:"obfs,omitempty"`
+	Protocol       string   `json:"protocol,omitempty"`
+	Up             string   `json:"up"`
+	Down           string   `json:"down"`
+	SNI            string   `json:"sni,omitempty"`
+	SkipCertVerify bool     `json:"skip-cert-verify,omitempty"`
+	ALPN           []string `json:"alpn,omitempty"`
+}
+
+func newHysteriaByLink(link string) (*hysteriaProxy, error) {
+	/**
+	hysteria://
+	    host
+	    :
+	    port
+	?
+	    protocol=$(udp|wechat-video|faketcp)&
+	    auth=$(auth-string)&
+	    peer=$(tls-sni.com)&
+	    insecure=$(0|1)&
+	    upmbps=$(100)&
+	    downmbps=$(100)&
+	    alpn=$(hysteria)&
+	    obfs=xplus&
+	    obfsParam=$(obfs-password)
+	#$(descriptive-text)
+	*/
+
+	uri, err := url.Parse(link)
+	if err != nil {
+		return nil, err
+	}
+
+	server := uri.Hostname()
+	port, _ := strconv.Atoi(uri.Port())
+	if server == "" || port == 0 {
+		return nil, fmt.Errorf("proxy: [hysteria] invalid link")
+	}
+
+	moreInfos := uri.Query()
+	p := &hysteriaProxy{
+		Base: &Base{
+			Type:   Hysteria,
+			Server: server,
+			Port:   port,
+			Link:   link,
+		},
+		AuthStr:        moreInfos.Get("auth"),
+		Protocol:       moreInfos.Get("protocol"),
+		Up:             bandwidth(moreInfos.Get("upmbps")),
+		Down:           bandwidth(moreInfos.Get("downmbps")),
+		SNI:            moreInfos.Get("peer"),
+		SkipCertVerify: boolParam(moreInfos.Get("insecure")),
+	}
+	if p.Up == "" || p.Down == "" {
+		return nil, fmt.Errorf("proxy: [hysteria] missing bandwidth")
+	}
+	if v := moreInfos.Get("alpn"); v != "" {
+		p.ALPN = strings.Split(v, ",")
+	}
+	if moreInfos.Get("obfs") != "" {
+		p.Obfs = moreInfos.Get("obfsParam")
+	}
+
+	return p, nil
+}
+
+func (p *hysteriaProxy) ConfigMap() (map[string]interface{}, error) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+
+	m := map[string]interface{}{}
+	err = json.Unmarshal(data, &m)
+	if err != nil {
+		return nil, err
+	}
+
+	m["port"] = int(m["port"].(float64))
+	return m, nil
+}
+
+func (p *hysteriaProxy) ToLink() (string, error) {
+	query := url.Values{}
+	query.Set("upmbps", strings.TrimSuffix(p.Up, " Mbps"))
+	query.Set("downmbps", strings.TrimSuffix(p.Down, " Mbps"))
+	if p.Protocol != "" {
+		query.Set("protocol", p.Protocol)
+	}
+	if p.AuthStr != "" {
+		query.Set("auth", p.AuthStr)
+	}
+	if p.SNI != "" {
+		query.Set("peer", p.SNI)
+	}
+	if p.SkipCertVerify {
+		query.Set("insecure", "1")
+	}
+	if len(p.ALPN) > 0 {
+		query.Set("alpn", strings.Join(p.ALPN, ","))
+	}
+	if p.Obfs != "" {
+		query.Set("obfs", "xplus")
+		query.Set("obfsParam", p.Obfs)
+	}
+
+	return buildLink(p.Base, "", query), nil
+}
+
+type hysteria2Proxy struct {
+	*Base
+	Password       string   `json:"password"`
+	Obfs           string   `json:"obfs,omitempty"`
+	ObfsPassword   string   `json:"obfs-password,omitempty"`
+	Up             string   `json:"up,omitempty"`
+	Down           string   `json:"down,omitempty"`
+	SNI            string   `json:"sni,omitempty"`
+	SkipCertVerify bool     `json:"skip-cert-verify,omitempty"`
+	ALPN           []string `json:"alpn,omitempty"`
+}
+
+func newHysteria2ByLink(link string) (*hysteria2Proxy, error) {
+	/**
+	hysteria2:// (or hy2://)
+	    $(auth)
+	    @
+	    host
+	    :
+	    port
+	/?
+	    sni=$(tls-sni.com)&
+	    insecure=$(0|1)&
+	    obfs=salamander&
+	    obfs-password=$(obfs-password)&
+	    up=$(100)&
+	    down=$(100)
+	#$(descriptive-text)
+	*/
+
+	uri, err := url.Parse(link)
+	if err != nil {
+		return nil, err
+	}
+
+	// the auth part may contain a colon, in that case it is "username:password"
+	password := uri.User.Username()
+	if v, ok := uri.User.Password(); ok {
+		password += ":" + v
+	}
+
+	server := uri.Hostname()
+	port, _ := strconv.Atoi(uri.Port())
+	if server == "" || port == 0 {
+		return nil, fmt.Errorf("proxy: [hysteria2] invalid link")
+	}
+
+	moreInfos := uri.Query()
+	p := &hysteria2Proxy{
+		Base: &Base{
+			Type:   Hysteria2,
+			Server: server,
+			Port:   port,
+			Link:   link,
+		},
+		Password:       password,
+		Obfs:           moreInfos.Get("obfs"),
+		ObfsPassword:   moreInfos.Get("obfs-password"),
+		Up:             bandwidth(moreInfos.Get("up")),
+		Down:           bandwidth(moreInfos.Get("down")),
+		SNI:            moreInfos.Get("sni"),
+		SkipCertVerify: boolParam(moreInfos.Get("insecure")),
+	}
+	if v := moreInfos.Get("alpn"); v != "" {
+		p.ALPN = strings.Split(v, ",")
+	}
+
+	return p, nil
+}
+
+func (p *hysteria2Proxy) ConfigMap() (map[string]interface{}, error) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+
+	m := map[string]interface{}{}
+	err = json.Unmarshal(data, &m)
+	if err != nil {
+		return nil, err
+	}
+
+	m["port"] = int(m["port"].(float64))
+	return m, nil
+}
+
+func (p *hysteria2Proxy) ToLink() (string, error) {
+	query := url.Values{}
+	if p.SNI != "" {
+		query.Set("sni", p.SNI)
+	}
+	if p.SkipCertVerify {
+		query.Set("insecure", "1")
+	}
+	if p.Obfs != "" {
+		query.Set("obfs", p.Obfs)
+		query.Set("obfs-password", p.ObfsPassword)
+	}
+	if p.Up != "" {
+		query.Set("up", strings.TrimSuffix(p.Up, " Mbps"))
+	}
+	if p.Down != "" {
+		query.Set("down", strings.TrimSuffix(p.Down, " Mbps"))
+	}
+	if len(p.ALPN) > 0 {
+		query.Set("alpn", strings.Join(p.ALPN, ","))
+	}
+
+	return buildLink(p.Base, p.Password, query), nil
+}
+
+// bandwidth normalizes a link bandwidth value, plain numbers are treated as Mbps.
+func bandwidth(v string) string {
+	v = strings.TrimSpace(v)
+	if _, err := strconv.Atoi(v); err == nil {
+		return v + " Mbps"
+	}
+	return v
+}
+
+func boolParam(v string) bool {
+	return v == "1" || v == "true"
+}
@@ -4,14 +4,22 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"net"
+	"net/url"
+	"strconv"
 	"strings"
 )
 
-var ErrInvalidLink = fmt.Errorf("proxy: invalid link")
+var (
+	ErrInvalidLink     = fmt.Errorf("proxy: invalid link")
+	ErrUnsupportedType = fmt.Errorf("proxy: unsupported type")
+)
 
 type Proxy interface {
 	GetBase() *Base
 	ConfigMap() (map[string]interface{}, error)
+	// ToLink regenerates the share link from the proxy config.
+	ToLink() (string, error)
 }
 
 var (
@@ -29,19 +37,30 @@ func (t Type) Prefix() string {
 }
 
 const (
-	SS     Type = "ss"
-	SSR    Type = "ssr"
-	Vmess  Type = "vmess"
-	Trojan Type = "trojan"
+	SS        Type = "ss"
+	SSR       Type = "ssr"
+	Vmess     Type = "vmess"
+	Trojan    Type = "trojan"
+	VLESS     Type = "vless"
+	Hysteria  Type = "hysteria"
+	Hysteria2 Type = "hysteria2"
 )
 
+// hy2Prefix is the short scheme some feeds use for hysteria2 links.
+const hy2Prefix = "hy2://"
+
+// Types are the parsable proxy types, VLESS and hysteria proxies are stored unvalidated, see validator.Supported.
+var Types = []Type{SS, SSR, Vmess, Trojan, VLESS, Hysteria, Hysteria2}
+
 type Base struct {
 	Name   string `json:"name" gorm:"-"`
 	Type   Type   `json:"type"`
-	Server string `json:"server" gorm:"uniqueIndex:idx_server_port"`
-	Port   int    `json:"port" gorm:"uniqueIndex:idx_server_port"`
+	Server string `json:"server" gorm:"index:idx_proxies_server_port"`
+	Port   int    `json:"port" gorm:"index:idx_proxies_server_port"`
 	Link   string `json:"-"`
 	Source string `json:"-"`
+	// Fingerprint is the identity of the proxy, see the Fingerprint function
+	Fingerprint string `json:"-" gorm:"uniqueIndex"`
 
 	Country     string `json:"-"`
 	CountryCode string `json:"-"`
@@ -63,6 +82,12 @@ func (b *Base) Restore(cm string) (Proxy, error) {
 		proxy = &vmessProxy{Base: b}
 	case Trojan:
 		proxy = &trojanProxy{Base: b}
+	case VLESS:
+		proxy = &vlessProxy{Base: b}
+	case Hysteria:
+		proxy = &hysteriaProxy{Base: b}
+	case Hysteria2:
+		proxy = &hysteria2Proxy{Base: b}
 	}
 
 	if err := json.Unmarshal([]byte(cm), proxy); err != nil {
@@ -72,7 +97,8 @@ func (b *Base) Restore(cm string) (Proxy, error) {
 	return proxy, nil
 }
 
-func base64Decode(src string) (string, error) {
+// Base64Decode decodes src with the standard and URL-safe encodings, padded or not.
+func Base64Decode(src string) (string, error) {
 	if src == "" {
 		return "", nil
 	}
@@ -92,6 +118,27 @@ func base64Decode(src string) (string, error) {
 	return "", fmt.Errorf("base64 decode error")
 }
 
+func base64Encode(src string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(src))
+}
+
+// buildLink assembles a URI style share link, the proxy name is used as the fragment.
+func buildLink(b *Base, userinfo string, query url.Values) string {
+	u := &url.URL{
+		Scheme:   b.Type.String(),
+		Host:     net.JoinHostPort(b.Server, strconv.Itoa(b.Port)),
+		Fragment: b.Name,
+	}
+	if userinfo != "" {
+		u.User = url.User(userinfo)
+	}
+	if len(query) > 0 {
+		u.Path = "/"
+		u.RawQuery = query.Encode()
+	}
+	return u.String()
+}
+
 func NewProxyByLink(link string) (Proxy, error) {
 	var (
 		p   Proxy
@@ -106,6 +153,12 @@ func NewProxyByLink(link string) (Proxy, error) {
 		p, err = newVmessByLink(link)
 	case strings.HasPrefix(link, Trojan.Prefix()):
 		p, err = newTrojanByLink(link)
+	case strings.HasPrefix(link, VLESS.Prefix()):
+		p, err = newVLESSByLink(link)
+	case strings.HasPrefix(link, Hysteria.Prefix()):
+		p, err = newHysteriaByLink(link)
+	case strings.HasPrefix(link, Hysteria2.Prefix()), strings.HasPrefix(link, hy2Prefix):
+		p, err = newHysteria2ByLink(link)
 	default:
 		err = ErrInvalidLink
 	}
@@ -113,12 +166,88 @@ func NewProxyByLink(link string) (Proxy, error) {
 	return p, err
 }
 
+// NewProxyByConfigMap creates a proxy from a Clash style proxy mapping.
+func NewProxyByConfigMap(m map[string]interface{}) (Proxy, error) {
+	t, _ := m["type"].(string)
+	valid := false
+	for _, v := range Types {
+		if v.String() == t {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedType, t)
+	}
+
+	m = normalizeConfigMap(Type(t), m)
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := (&Base{Type: Type(t)}).Restore(string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	b := p.GetBase()
+	if b.Server == "" || b.Port == 0 {
+		return nil, fmt.Errorf("proxy: [%s] invalid config", t)
+	}
+	b.Link, _ = p.ToLink()
+	return p, nil
+}
+
+// normalizeConfigMap converts the values which Clash accepts in several forms to the ones used by the proxy structs.
+func normalizeConfigMap(t Type, m map[string]interface{}) map[string]interface{} {
+	nm := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		nm[k] = v
+	}
+
+	if v, ok := nm["port"].(string); ok {
+		nm["port"], _ = strconv.Atoi(v)
+	}
+
+	switch t {
+	case SSR:
+		for from, to := range map[string]string{"obfs-param": "obfs_param", "protocol-param": "protocol_param"} {
+			if v, ok := nm[from]; ok {
+				if _, ok := nm[to]; !ok {
+					nm[to] = v
+				}
+				delete(nm, from)
+			}
+		}
+	case Vmess:
+		if v, ok := nm["alterId"].(string); ok {
+			nm["alterId"], _ = strconv.Atoi(v)
+		}
+	case Hysteria, Hysteria2:
+		if v, ok := nm["auth_str"]; ok {
+			if _, ok := nm["auth-str"]; !ok {
+				nm["auth-str"] = v
+			}
+			delete(nm, "auth_str")
+		}
+		for _, k := range []string{"up", "down"} {
+			switch v := nm[k].(type) {
+			case int, float64:
+				nm[k] = fmt.Sprintf("%v Mbps", v)
+			}
+		}
+	}
+
+	return nm
+}
+
 func LinkValid(link string) bool {
-	for _, t := range []Type{SS, SSR, Vmess, Trojan} {
+	for _, t := range Types {
 		if strings.HasPrefix(link, t.Prefix()) {
 			return true
 		}
 	}
 
-	return false
+	return strings.HasPrefix(link, hy2Prefix)
 }
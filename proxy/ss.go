@@ -27,7 +27,7 @@ func newSSByLink(link string) (*ssProxy, error) {
 	cipher := ""
 	password := ""
 	if uri.User.String() == "" {
-		infos, err := base64Decode(uri.Hostname())
+		infos, err := Base64Decode(uri.Hostname())
 		if err != nil {
 			return nil, err
 		}
@@ -38,7 +38,7 @@ func newSSByLink(link string) (*ssProxy, error) {
 		cipher = uri.User.Username()
 		password, _ = uri.User.Password()
 	} else {
-		cipherInfoString, err := base64Decode(uri.User.Username())
+		cipherInfoString, err := Base64Decode(uri.User.Username())
 		if err != nil {
 			return nil, fmt.Errorf("proxy: [ss] %w", err)
 		}
@@ -57,7 +57,7 @@ func newSSByLink(link string) (*ssProxy, error) {
 	plugin := ""
 	pluginOpts := make(map[string]interface{})
 	if strings.Contains(pluginString, ";") {
-		pluginInfos, err := url.ParseQuery(pluginString)
+		pluginInfos, err := url.ParseQuery(strings.ReplaceAll(pluginString, ";", "&"))
 		if err == nil {
 			if strings.Contains(pluginString, "obfs") {
 				plugin = "obfs"
@@ -104,3 +104,37 @@ func (p *ssProxy) ConfigMap() (map[string]interface{}, error) {
 	m["port"] = int(m["port"].(float64))
 	return m, nil
 }
+
+// ToLink returns the SIP002 link of the proxy.
+func (p *ssProxy) ToLink() (string, error) {
+	query := url.Values{}
+	if p.Plugin != "" {
+		opts := []string{}
+		switch p.Plugin {
+		case "obfs":
+			opts = append(opts, "obfs-local")
+			if v, ok := p.PluginOpts["mode"].(string); ok && v != "" {
+				opts = append(opts, "obfs="+v)
+			}
+			if v, ok := p.PluginOpts["host"].(string); ok && v != "" {
+				opts = append(opts, "obfs-host="+v)
+			}
+		case "v2ray-plugin":
+			opts = append(opts, "v2ray-plugin")
+			if v, ok := p.PluginOpts["mode"].(string); ok && v != "" {
+				opts = append(opts, "mode="+v)
+			}
+			if v, ok := p.PluginOpts["host"].(string); ok && v != "" {
+				opts = append(opts, "host="+v)
+			}
+			if v, ok := p.PluginOpts["tls"].(bool); ok && v {
+				opts = append(opts, "tls")
+			}
+		default:
+			return "", fmt.Errorf("proxy: [ss] unsupported plugin: %s", p.Plugin)
+		}
+		query.Set("plugin", strings.Join(opts, ";"))
+	}
+
+	return buildLink(p.Base, base64Encode(p.Cipher+":"+p.Password), query), nil
+}
@@ -3,6 +3,7 @@ package proxy
 import (
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/url"
 	"strconv"
 	"strings"
@@ -21,10 +22,12 @@ type ssrProxy struct {
 func newSSRByLink(link string) (*ssrProxy, error) {
 	originLink := link
 	link = strings.TrimPrefix(link, "ssr://")
+	// the links are URL-safe encoded, some feeds use an en dash instead of "-"
 	link = strings.ReplaceAll(link, "–", "+")
+	link = strings.ReplaceAll(link, "-", "+")
 	link = strings.ReplaceAll(link, "_", "/")
 
-	decodeLink, err := base64Decode(link)
+	decodeLink, err := Base64Decode(link)
 	if err != nil {
 		return nil, err
 	}
@@ -47,24 +50,24 @@ func newSSRByLink(link string) (*ssrProxy, error) {
 	protocol := ssrInfo[2]
 	cipher := ssrInfo[3]
 	obfs := ssrInfo[4]
-	password, err := base64Decode(ssrInfo[5])
+	password, err := Base64Decode(ssrInfo[5])
 	if err != nil {
 		return nil, fmt.Errorf("parser: invalid ssr password: %s", link)
 	}
 
-	params, err := url.ParseQuery(ssrInfo[1])
+	params, err := url.ParseQuery(linkInfo[1])
 	if err != nil {
 		return nil, fmt.Errorf("parser: invalid ssr params: %s", link)
 	}
 
 	// protocol param
-	protocolParam, err := base64Decode(params.Get("protoparam"))
+	protocolParam, err := Base64Decode(params.Get("protoparam"))
 	if err != nil {
 		return nil, fmt.Errorf("parser: invalid ssr protoparam: %s", link)
 	}
 
 	// obfs param
-	obfsParam, err := base64Decode(params.Get("obfsparam"))
+	obfsParam, err := Base64Decode(params.Get("obfsparam"))
 	if err != nil {
 		return nil, fmt.Errorf("parser: invalid ssr obfsparam: %s", link)
 	}
@@ -105,3 +108,25 @@ func (p *ssrProxy) ConfigMap() (map[string]interface{}, error) {
 	m["port"] = int(m["port"].(float64))
 	return m, nil
 }
+
+func (p *ssrProxy) ToLink() (string, error) {
+	cipher := p.Cipher
+	if cipher == "dummy" {
+		cipher = "none"
+	}
+
+	info := strings.Join([]string{
+		net.JoinHostPort(p.Server, strconv.Itoa(p.Port)),
+		p.Protocol,
+		cipher,
+		p.Obfs,
+		base64Encode(p.Password),
+	}, ":")
+
+	params := url.Values{}
+	params.Set("obfsparam", base64Encode(p.ObfsParam))
+	params.Set("protoparam", base64Encode(p.ProtocolParam))
+	params.Set("remarks", base64Encode(p.Name))
+
+	return SSR.Prefix() + base64Encode(info+"/?"+params.Encode()), nil
+}
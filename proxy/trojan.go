@@ -5,15 +5,19 @@ import (
 	"fmt"
 	"net/url"
 	"strconv"
+	"strings"
 )
 
 type trojanProxy struct {
 	*Base
-	Password       string   `json:"password"`
-	ALPN           []string `json:"alpn,omitempty"`
-	SNI            string   `json:"sni,omitempty"`
-	SkipCertVerify bool     `json:"skip-cert-verify"`
-	UDP            bool     `json:"udp"`
+	Password       string       `json:"password"`
+	ALPN           []string     `json:"alpn,omitempty"`
+	SNI            string       `json:"sni,omitempty"`
+	SkipCertVerify bool         `json:"skip-cert-verify"`
+	UDP            bool         `json:"udp"`
+	Network        string       `json:"network,omitempty"`
+	WSOpts         *WSOptions   `json:"ws-opts,omitempty"`
+	GrpcOpts       *GrpcOptions `json:"grpc-opts,omitempty"`
 }
 
 func newTrojanByLink(link string) (*trojanProxy, error) {
@@ -60,22 +64,41 @@ func newTrojanByLink(link string) (*trojanProxy, error) {
 		alpn = append(alpn, "h2")
 	}
 
+	if sni == "" {
+		sni = host
+	}
+
 	if port == 0 {
 		return nil, fmt.Errorf("invalid port")
 	}
 
-	return &trojanProxy{
+	p := &trojanProxy{
 		Base: &Base{
 			Server: server,
 			Port:   port,
-			Type:   "trojan",
+			Type:   Trojan,
+			Link:   link,
 		},
 		Password:       password,
 		ALPN:           alpn,
 		UDP:            true,
-		SNI:            host,
+		SNI:            sni,
 		SkipCertVerify: true,
-	}, nil
+	}
+
+	switch transformType {
+	case "ws":
+		p.Network = transformType
+		p.WSOpts = &WSOptions{Path: path}
+		if host != "" {
+			p.WSOpts.Headers = map[string]string{"Host": host}
+		}
+	case "grpc":
+		p.Network = transformType
+		p.GrpcOpts = &GrpcOptions{GrpcServiceName: moreInfos.Get("serviceName")}
+	}
+
+	return p, nil
 }
 
 func (p *trojanProxy) ConfigMap() (map[string]interface{}, error) {
@@ -92,3 +115,33 @@ func (p *trojanProxy) ConfigMap() (map[string]interface{}, error) {
 
 	return m, nil
 }
+
+func (p *trojanProxy) ToLink() (string, error) {
+	query := url.Values{}
+	if p.SNI != "" {
+		query.Set("sni", p.SNI)
+	}
+	if len(p.ALPN) > 0 {
+		query.Set("alpn", strings.Join(p.ALPN, ","))
+	}
+	if p.SkipCertVerify {
+		query.Set("allowInsecure", "1")
+	}
+	switch {
+	case p.WSOpts != nil:
+		query.Set("type", "ws")
+		if p.WSOpts.Path != "" {
+			query.Set("path", p.WSOpts.Path)
+		}
+		if v := p.WSOpts.Headers["Host"]; v != "" {
+			query.Set("host", v)
+		}
+	case p.GrpcOpts != nil:
+		query.Set("type", "grpc")
+		if p.GrpcOpts.GrpcServiceName != "" {
+			query.Set("serviceName", p.GrpcOpts.GrpcServiceName)
+		}
+	}
+
+	return buildLink(p.Base, p.Password, query), nil
+}
@@ -0,0 +1,229 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+type vlessProxy struct {
+	*Base
+	UUID              string          `json:"uuid"`
+	Flow              string          `json:"flow,omitempty"`
+	UDP               bool            `json:"udp"`
+	TLS               bool            `json:"tls,omitempty"`
+	ServerName        string          `json:"servername,omitempty"`
+	SkipCertVerify    bool            `json:"skip-cert-verify,omitempty"`
+	ClientFingerprint string          `json:"client-fingerprint,omitempty"`
+	ALPN              []string        `json:"alpn,omitempty"`
+	Network           string          `json:"network,omitempty"`
+	WSOpts            *WSOptions      `json:"ws-opts,omitempty"`
+	GrpcOpts          *GrpcOptions    `json:"grpc-opts,omitempty"`
+	HTTP2Opts         *HTTP2Options   `json:"h2-opts,omitempty"`
+	RealityOpts       *RealityOptions `json:"reality-opts,omitempty"`
+}
+
+type WSOptions struct {
+	Path    string            `json:"path,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+type GrpcOptions struct {
+	GrpcServiceName string `json:"grpc-service-name,omitempty"`
+}
+
+type HTTP2Options struct {
+	Host []string `json:"host,omitempty"`
+	Path string   `json:"path,omitempty"`
+}
+
+type RealityOptions struct {
+	PublicKey string `json:"public-key"`
+	ShortID   string `json:"short-id,omitempty"`
+}
+
+func newVLESSByLink(link string) (*vlessProxy, error) {
+	/**
+	vless://
+	    $(uuid)
+	    @
+	    host
+	    :
+	    port
+	?
+	    encryption=none&
+	    flow=$(xtls-rprx-vision)&
+	    security=$(none|tls|reality)&
+	        sni=$(tls-sni.com)&
+	        fp=$(chrome)&
+	        alpn=$(h2,http/1.1)&
+	        pbk=$(reality-public-key)&
+	        sid=$(reality-short-id)&
+	    type=$(tcp|ws|grpc|h2|http)&
+	        host=$(transport-host.com)&
+	        path=$(/transport/path)&
+	        serviceName=$(grpc-service-name)
+	#$(descriptive-text)
+	*/
+
+	uri, err := url.Parse(link)
+	if err != nil {
+		return nil, err
+	}
+
+	uuid := uri.User.Username()
+	server := uri.Hostname()
+	port, _ := strconv.Atoi(uri.Port())
+	if uuid == "" || server == "" || port == 0 {
+		return nil, fmt.Errorf("proxy: [vless] invalid link")
+	}
+
+	moreInfos := uri.Query()
+	p := &vlessProxy{
+		Base: &Base{
+			Type:   VLESS,
+			Server: server,
+			Port:   port,
+			Link:   link,
+		},
+		UUID:              uuid,
+		Flow:              moreInfos.Get("flow"),
+		UDP:               true,
+		ServerName:        moreInfos.Get("sni"),
+		ClientFingerprint: moreInfos.Get("fp"),
+		SkipCertVerify:    boolParam(moreInfos.Get("allowInsecure")),
+	}
+
+	if v := moreInfos.Get("alpn"); v != "" {
+		p.ALPN = strings.Split(v, ",")
+	}
+
+	switch security := moreInfos.Get("security"); security {
+	case "", "none":
+	case "tls", "xtls":
+		p.TLS = true
+	case "reality":
+		p.TLS = true
+		p.RealityOpts = &RealityOptions{
+			PublicKey: moreInfos.Get("pbk"),
+			ShortID:   moreInfos.Get("sid"),
+		}
+		if p.RealityOpts.PublicKey == "" {
+			return nil, fmt.Errorf("proxy: [vless] missing reality public key")
+		}
+	default:
+		return nil, fmt.Errorf("proxy: [vless] unsupported security: %s", security)
+	}
+
+	host := moreInfos.Get("host")
+	path := moreInfos.Get("path")
+	switch network := moreInfos.Get("type"); network {
+	case "", "tcp":
+	case "ws":
+		p.Network = network
+		p.WSOpts = &WSOptions{Path: path}
+		if host != "" {
+			p.WSOpts.Headers = map[string]string{"Host": host}
+		}
+	case "grpc":
+		p.Network = network
+		p.GrpcOpts = &GrpcOptions{GrpcServiceName: moreInfos.Get("serviceName")}
+	case "h2", "http":
+		p.Network = "h2"
+		p.HTTP2Opts = &HTTP2Options{Path: path}
+		if host != "" {
+			p.HTTP2Opts.Host = strings.Split(host, ",")
+		}
+	default:
+		return nil, fmt.Errorf("proxy: [vless] unsupported transport: %s", network)
+	}
+
+	if p.TLS && p.ServerName == "" && host != "" {
+		p.ServerName = host
+	}
+
+	return p, nil
+}
+
+func (p *vlessProxy) ConfigMap() (map[string]interface{}, error) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+
+	m := map[string]interface{}{}
+	err = json.Unmarshal(data, &m)
+	if err != nil {
+		return nil, err
+	}
+
+	m["port"] = int(m["port"].(float64))
+	return m, nil
+}
+
+func (p *vlessProxy) ToLink() (string, error) {
+	query := url.Values{}
+	query.Set("encryption", "none")
+	if p.Flow != "" {
+		query.Set("flow", p.Flow)
+	}
+
+	switch {
+	case p.RealityOpts != nil:
+		query.Set("security", "reality")
+		query.Set("pbk", p.RealityOpts.PublicKey)
+		if p.RealityOpts.ShortID != "" {
+			query.Set("sid", p.RealityOpts.ShortID)
+		}
+	case p.TLS:
+		query.Set("security", "tls")
+	}
+	if p.ServerName != "" {
+		query.Set("sni", p.ServerName)
+	}
+	if p.ClientFingerprint != "" {
+		query.Set("fp", p.ClientFingerprint)
+	}
+	if len(p.ALPN) > 0 {
+		query.Set("alpn", strings.Join(p.ALPN, ","))
+	}
+	if p.SkipCertVerify {
+		query.Set("allowInsecure", "1")
+	}
+
+	switch p.Network {
+	case "", "tcp":
+		query.Set("type", "tcp")
+	case "ws":
+		query.Set("type", "ws")
+		if p.WSOpts != nil {
+			if p.WSOpts.Path != "" {
+				query.Set("path", p.WSOpts.Path)
+			}
+			if v := p.WSOpts.Headers["Host"]; v != "" {
+				query.Set("host", v)
+			}
+		}
+	case "grpc":
+		query.Set("type", "grpc")
+		if p.GrpcOpts != nil && p.GrpcOpts.GrpcServiceName != "" {
+			query.Set("serviceName", p.GrpcOpts.GrpcServiceName)
+		}
+	case "h2":
+		query.Set("type", "h2")
+		if p.HTTP2Opts != nil {
+			if p.HTTP2Opts.Path != "" {
+				query.Set("path", p.HTTP2Opts.Path)
+			}
+			if len(p.HTTP2Opts.Host) > 0 {
+				query.Set("host", strings.Join(p.HTTP2Opts.Host, ","))
+			}
+		}
+	default:
+		return "", fmt.Errorf("proxy: [vless] unsupported transport: %s", p.Network)
+	}
+
+	return buildLink(p.Base, p.UUID, query), nil
+}
@@ -1,6 +1,7 @@
 package proxy
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"strconv"
 	"strings"
@@ -16,6 +17,9 @@ type vmessProxy struct {
 	HTTPOpts       HTTPOptions       `json:"http-opts,omitempty"`
 	WSPath         string            `json:"ws-path,omitempty"`
 	WSHeaders      map[string]string `json:"ws-headers,omitempty"`
+	WSOpts         *WSOptions        `json:"ws-opts,omitempty"`
+	HTTP2Opts      *HTTP2Options     `json:"h2-opts,omitempty"`
+	GrpcOpts       *GrpcOptions      `json:"grpc-opts,omitempty"`
 	SkipCertVerify bool              `json:"skip-cert-verify,omitempty"`
 	ServerName     string            `json:"servername,omitempty"`
 }
@@ -29,7 +33,7 @@ type HTTPOptions struct {
 func newVmessByLink(link string) (*vmessProxy, error) {
 	originLink := link
 	link = strings.TrimPrefix(link, "vmess://")
-	decodeStr, err := base64Decode(link)
+	decodeStr, err := Base64Decode(link)
 	if err != nil {
 		return nil, err
 	}
@@ -55,8 +59,8 @@ func newVmessByLink(link string) (*vmessProxy, error) {
 
 	port := 0
 	switch v := resp.Port.(type) {
-	case int:
-		port = v
+	case float64:
+		port = int(v)
 	case string:
 		port, err = strconv.Atoi(v)
 		if err != nil {
@@ -66,8 +70,8 @@ func newVmessByLink(link string) (*vmessProxy, error) {
 
 	alterId := 0
 	switch v := resp.Aid.(type) {
-	case int:
-		alterId = v
+	case float64:
+		alterId = int(v)
 	case string:
 		alterId, err = strconv.Atoi(v)
 		if err != nil {
@@ -84,6 +88,10 @@ func newVmessByLink(link string) (*vmessProxy, error) {
 	if resp.Path == "" {
 		resp.Path = "/"
 	}
+	// plain TCP is the default network of clash
+	if resp.Net == "tcp" {
+		resp.Net = ""
+	}
 
 	return &vmessProxy{
 		Base: &Base{
@@ -121,3 +129,48 @@ func (p *vmessProxy) ConfigMap() (map[string]interface{}, error) {
 	m["alterId"] = int(m["alterId"].(float64))
 	return m, nil
 }
+
+// ToLink returns the v2rayN style link of the proxy.
+func (p *vmessProxy) ToLink() (string, error) {
+	host, path := p.WSHeaders["HOST"], p.WSPath
+	switch {
+	case p.WSOpts != nil:
+		host, path = p.WSOpts.Headers["Host"], p.WSOpts.Path
+	case p.HTTP2Opts != nil:
+		host, path = strings.Join(p.HTTP2Opts.Host, ","), p.HTTP2Opts.Path
+	case p.GrpcOpts != nil:
+		path = p.GrpcOpts.GrpcServiceName
+	}
+	if host == "" {
+		host = p.ServerName
+	}
+	tls := ""
+	if p.TLS {
+		tls = "tls"
+	}
+	network := p.Network
+	if network == "" {
+		network = "tcp"
+	}
+
+	data, err := json.Marshal(map[string]string{
+		"v":    "2",
+		"ps":   p.Name,
+		"add":  p.Server,
+		"port": strconv.Itoa(p.Port),
+		"id":   p.UUID,
+		"aid":  strconv.Itoa(p.AlterID),
+		"scy":  p.Cipher,
+		"net":  network,
+		"type": "none",
+		"host": host,
+		"path": path,
+		"tls":  tls,
+		"sni":  p.ServerName,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return Vmess.Prefix() + base64.StdEncoding.EncodeToString(data), nil
+}
@@ -0,0 +1,129 @@
+package freeproxy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+
+	"github.com/xwjdsh/freeproxy/storage"
+)
+
+type SourcesOptions struct {
+	// Name displays every run of the source if set
+	Name string
+	// Runs is the number of latest runs of every source to display
+	Runs int
+}
+
+type sourceSummary struct {
+	Name           string
+	Runs           int
+	FailedRuns     int
+	Seen           int
+	ParseFailed    int
+	ValidateFailed int
+	Duplicated     int
+	Created        int
+	Duration       time.Duration
+	LastRunAt      time.Time
+	LastError      string
+}
+
+// Sources displays the fetch statistics of the sources.
+func (h *Handler) Sources(ctx context.Context, opts *SourcesOptions) error {
+	ss, err := h.storage.GetSources(ctx, &storage.SourceQueryOptions{
+		Name: opts.Name,
+		Runs: opts.Runs,
+	})
+	if err != nil {
+		return err
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetAutoFormatHeaders(false)
+	table.SetBorder(false)
+	table.SetAlignment(tablewriter.ALIGN_CENTER)
+
+	if opts.Name != "" {
+		table.SetHeader([]string{"Time", "Seen", "ParseFailed", "ValidateFailed", "Duplicated", "Created", "Yield", "Duration", "Error"})
+		for _, s := range ss {
+			table.Append([]string{
+				s.CreatedAt.Format("2006-01-02 15:04:05"),
+				strconv.Itoa(s.Seen),
+				strconv.Itoa(s.ParseFailed),
+				strconv.Itoa(s.ValidateFailed),
+				strconv.Itoa(s.Duplicated),
+				strconv.Itoa(s.Created),
+				percent(s.Created, s.Seen),
+				s.Duration.Round(time.Millisecond).String(),
+				s.Error,
+			})
+		}
+		table.Render()
+		return nil
+	}
+
+	items := summarizeSources(ss)
+	table.SetHeader([]string{"Source", "Runs", "Reliability", "Seen", "ParseFailed", "ValidateFailed", "Duplicated", "Created", "Yield", "AvgDuration", "LastRun", "LastError"})
+	for _, item := range items {
+		table.Append([]string{
+			item.Name,
+			strconv.Itoa(item.Runs),
+			percent(item.Runs-item.FailedRuns, item.Runs),
+			strconv.Itoa(item.Seen),
+			strconv.Itoa(item.ParseFailed),
+			strconv.Itoa(item.ValidateFailed),
+			strconv.Itoa(item.Duplicated),
+			strconv.Itoa(item.Created),
+			percent(item.Created, item.Seen),
+			(item.Duration / time.Duration(item.Runs)).Round(time.Millisecond).String(),
+			item.LastRunAt.Format("2006-01-02 15:04:05"),
+			item.LastError,
+		})
+	}
+	table.Render()
+	return nil
+}
+
+// summarizeSources sums up the runs of every source, the runs are the latest first.
+// The sources which created the most proxies come first.
+func summarizeSources(ss []*storage.Source) []*sourceSummary {
+	m := map[string]*sourceSummary{}
+	items := []*sourceSummary{}
+	for _, s := range ss {
+		item := m[s.Name]
+		if item == nil {
+			// the latest run comes first
+			item = &sourceSummary{Name: s.Name, LastRunAt: s.CreatedAt, LastError: s.Error}
+			m[s.Name] = item
+			items = append(items, item)
+		}
+		item.Runs += 1
+		if s.Error != "" {
+			item.FailedRuns += 1
+		}
+		item.Seen += s.Seen
+		item.ParseFailed += s.ParseFailed
+		item.ValidateFailed += s.ValidateFailed
+		item.Duplicated += s.Duplicated
+		item.Created += s.Created
+		item.Duration += s.Duration
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Created > items[j].Created
+	})
+	return items
+}
+
+func percent(a, b int) string {
+	if b == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", float64(a)*100/float64(b))
+}
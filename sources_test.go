@@ -0,0 +1,38 @@
+package freeproxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xwjdsh/freeproxy/storage"
+)
+
+func TestSummarizeSources(t *testing.T) {
+	now := time.Now()
+	items := summarizeSources([]*storage.Source{
+		{Name: "a", CreatedAt: now, Seen: 10, Created: 1, Duration: time.Second, Error: "timeout"},
+		{Name: "b", CreatedAt: now, Seen: 20, ParseFailed: 2, ValidateFailed: 8, Duplicated: 5, Created: 5, Duration: 3 * time.Second},
+		{Name: "a", CreatedAt: now.Add(-time.Hour), Seen: 10, Created: 2, Duration: 3 * time.Second},
+	})
+
+	require.Len(t, items, 2)
+	assert.Equal(t, "b", items[0].Name)
+	assert.Equal(t, 1, items[0].Runs)
+
+	a := items[1]
+	assert.Equal(t, "a", a.Name)
+	assert.Equal(t, 2, a.Runs)
+	assert.Equal(t, 1, a.FailedRuns)
+	assert.Equal(t, 20, a.Seen)
+	assert.Equal(t, 3, a.Created)
+	assert.Equal(t, 4*time.Second, a.Duration)
+	// the latest run decides the last error
+	assert.Equal(t, now, a.LastRunAt)
+	assert.Equal(t, "timeout", a.LastError)
+
+	assert.Equal(t, "50.0%", percent(1, 2))
+	assert.Equal(t, "-", percent(1, 0))
+}
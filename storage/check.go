@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+)
+
+// Check is a validation result of a proxy.
+type Check struct {
+	ID         uint      `gorm:"primarykey"`
+	CreatedAt  time.Time `gorm:"index"`
+	ProxyID    uint      `gorm:"index"`
+	Delay      uint16
+	Success    bool
+	ErrorClass string
+}
+
+// CheckStats are the metrics derived from the latest checks of a proxy.
+type CheckStats struct {
+	SuccessRate float64
+	// MedianDelay and Jitter are computed from the successful checks, Jitter is the standard deviation
+	MedianDelay uint16
+	Jitter      uint16
+	LastOKAt    *time.Time
+}
+
+// RecordCheck saves the check, updates and returns the derived metrics of the proxy.
+// The checks of the proxy outside the window are removed.
+func (h *Handler) RecordCheck(ctx context.Context, c *Check) (*CheckStats, error) {
+	if err := h.db.Create(c).Error; err != nil {
+		return nil, err
+	}
+	if err := h.pruneChecks(ctx, c.ProxyID, h.cfg.CheckWindow); err != nil {
+		return nil, err
+	}
+
+	checks, err := h.GetChecks(ctx, c.ProxyID, h.cfg.CheckWindow)
+	if err != nil {
+		return nil, err
+	}
+	stats := checkStats(checks)
+
+	updates := map[string]interface{}{
+		"success_rate": stats.SuccessRate,
+		"median_delay": stats.MedianDelay,
+		"jitter":       stats.Jitter,
+		"unhealthy":    !c.Success,
+	}
+	// the older successful checks are pruned, the last success time is kept then
+	if stats.LastOKAt != nil {
+		updates["last_ok_at"] = stats.LastOKAt
+	}
+	if c.Success {
+		updates["delay"] = c.Delay
+	}
+	return stats, h.db.Model(&Proxy{}).Where("id = ?", c.ProxyID).Updates(updates).Error
+}
+
+// GetChecks returns the latest checks of the proxy, the latest first, all checks if limit is not positive.
+func (h *Handler) GetChecks(ctx context.Context, proxyID uint, limit int) ([]*Check, error) {
+	checks := []*Check{}
+	db := h.db.Where("proxy_id = ?", proxyID).Order("created_at DESC, id DESC")
+	if limit > 0 {
+		db = db.Limit(limit)
+	}
+	return checks, db.Find(&checks).Error
+}
+
+// pruneChecks removes the checks of the proxy except the latest keep ones, nothing if keep is not positive.
+func (h *Handler) pruneChecks(ctx context.Context, proxyID uint, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+	latest := h.db.Model(&Check{}).Select("id").Where("proxy_id = ?", proxyID).Order("created_at DESC, id DESC").Limit(keep)
+	return h.db.Where("proxy_id = ? AND id NOT IN (?)", proxyID, latest).Delete(&Check{}).Error
+}
+
+func checkStats(checks []*Check) *CheckStats {
+	stats := &CheckStats{}
+	if len(checks) == 0 {
+		return stats
+	}
+
+	delays := []float64{}
+	for _, c := range checks {
+		if !c.Success {
+			continue
+		}
+		delays = append(delays, float64(c.Delay))
+		if stats.LastOKAt == nil || c.CreatedAt.After(*stats.LastOKAt) {
+			t := c.CreatedAt
+			stats.LastOKAt = &t
+		}
+	}
+	stats.SuccessRate = float64(len(delays)) / float64(len(checks))
+	if len(delays) == 0 {
+		return stats
+	}
+
+	sort.Float64s(delays)
+	median := delays[len(delays)/2]
+	if len(delays)%2 == 0 {
+		median = (delays[len(delays)/2-1] + delays[len(delays)/2]) / 2
+	}
+	stats.MedianDelay = uint16(median)
+
+	mean := 0.0
+	for _, d := range delays {
+		mean += d
+	}
+	mean /= float64(len(delays))
+	variance := 0.0
+	for _, d := range delays {
+		variance += (d - mean) * (d - mean)
+	}
+	stats.Jitter = uint16(math.Sqrt(variance / float64(len(delays))))
+
+	return stats
+}
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckStats(t *testing.T) {
+	now := time.Now()
+	check := func(ago time.Duration, success bool, delay uint16) *Check {
+		return &Check{CreatedAt: now.Add(-ago), Success: success, Delay: delay}
+	}
+	at := func(ago time.Duration) *time.Time {
+		t := now.Add(-ago)
+		return &t
+	}
+
+	for _, c := range []struct {
+		name   string
+		checks []*Check
+		stats  *CheckStats
+	}{
+		{"empty", nil, &CheckStats{}},
+		{"failed", []*Check{check(0, false, 0), check(time.Hour, false, 0)}, &CheckStats{}},
+		{
+			"odd",
+			[]*Check{check(0, true, 100), check(time.Hour, false, 0), check(2*time.Hour, true, 300), check(3*time.Hour, true, 200)},
+			// the delays are 100, 200, 300, the standard deviation is 81.6
+			&CheckStats{SuccessRate: 0.75, MedianDelay: 200, Jitter: 81, LastOKAt: at(0)},
+		},
+		{
+			"even",
+			[]*Check{check(time.Hour, false, 0), check(2*time.Hour, true, 100), check(3*time.Hour, true, 300)},
+			&CheckStats{SuccessRate: 2.0 / 3, MedianDelay: 200, Jitter: 100, LastOKAt: at(2 * time.Hour)},
+		},
+	} {
+		assert.Equal(t, c.stats, checkStats(c.checks), c.name)
+	}
+}
+
+func TestRecordCheck(t *testing.T) {
+	ctx := context.Background()
+	h := newTestHandler(t, filepath.Join(t.TempDir(), "db"))
+	h.cfg.CheckWindow = 3
+
+	p, _, err := h.Create(ctx, newTestProxy(t, "a", ssConfig("1.1.1.1", "x")))
+	require.Nil(t, err)
+	other, _, err := h.Create(ctx, newTestProxy(t, "a", ssConfig("2.2.2.2", "x")))
+	require.Nil(t, err)
+	_, err = h.RecordCheck(ctx, &Check{ProxyID: other.ID, Success: true, Delay: 10})
+	require.Nil(t, err)
+
+	var stats *CheckStats
+	for i, success := range []bool{true, true, false, true, false} {
+		stats, err = h.RecordCheck(ctx, &Check{ProxyID: p.ID, Success: success, Delay: uint16(100 * (i + 1))})
+		require.Nil(t, err)
+	}
+	assert.InDelta(t, 1.0/3, stats.SuccessRate, 1e-9)
+	assert.Equal(t, uint16(400), stats.MedianDelay)
+
+	// the checks outside the window are removed, the other proxies are not affected
+	checks, err := h.GetChecks(ctx, p.ID, 0)
+	require.Nil(t, err)
+	require.Len(t, checks, 3)
+	assert.Equal(t, []bool{false, true, false}, []bool{checks[0].Success, checks[1].Success, checks[2].Success})
+	checks, err = h.GetChecks(ctx, other.ID, 0)
+	require.Nil(t, err)
+	assert.Len(t, checks, 1)
+
+	got := &Proxy{}
+	require.Nil(t, h.db.First(got, p.ID).Error)
+	assert.True(t, got.Unhealthy)
+	// the delay is updated by the successful checks only
+	assert.Equal(t, uint16(400), got.Delay)
+	require.NotNil(t, got.LastOKAt)
+	lastOK := *got.LastOKAt
+
+	// the last success time is kept after the successful checks are pruned
+	for i := 0; i < 3; i++ {
+		_, err = h.RecordCheck(ctx, &Check{ProxyID: p.ID})
+		require.Nil(t, err)
+	}
+	got = &Proxy{}
+	require.Nil(t, h.db.First(got, p.ID).Error)
+	assert.Zero(t, got.SuccessRate)
+	require.NotNil(t, got.LastOKAt)
+	assert.True(t, lastOK.Equal(*got.LastOKAt))
+}
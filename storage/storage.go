@@ -25,6 +25,26 @@ type Proxy struct {
 	UpdatedAt time.Time
 	*proxy.Base
 	Config string
+
+	// the metrics derived from the latest checks, see CheckStats
+	SuccessRate float64
+	MedianDelay uint16
+	Jitter      uint16
+	LastOKAt    *time.Time
+	// Unhealthy is set if the latest check failed
+	Unhealthy bool
+
+	// EntryIP is the resolved server IP, ExitIP is the IP the proxy connects out from
+	EntryIP         string
+	ExitIP          string
+	ExitCountry     string
+	ExitCountryCode string
+	// ExitCheckedAt is the time the exit IP was looked up, nil if never
+	ExitCheckedAt *time.Time
+	// Speed is the download speed in kbps, 0 if not measured
+	Speed uint
+	// UDPOK is the result of the UDP check, nil if not checked
+	UDPOK *bool `gorm:"column:udp_ok"`
 }
 
 func NewProxy(p proxy.Proxy) (*Proxy, error) {
@@ -43,21 +63,69 @@ func NewProxy(p proxy.Proxy) (*Proxy, error) {
 	}, nil
 }
 
+// ProxySource records a source where the proxy has been seen.
+type ProxySource struct {
+	ID          uint   `gorm:"primarykey"`
+	ProxyID     uint   `gorm:"uniqueIndex:idx_proxy_source"`
+	Source      string `gorm:"uniqueIndex:idx_proxy_source"`
+	FirstSeenAt time.Time
+	LastSeenAt  time.Time
+}
+
+// ProfileResult is the latest validation result of a proxy for a profile.
+type ProfileResult struct {
+	ID        uint `gorm:"primarykey"`
+	UpdatedAt time.Time
+	ProxyID   uint   `gorm:"uniqueIndex:idx_proxy_profile"`
+	Profile   string `gorm:"uniqueIndex:idx_proxy_profile"`
+	Success   bool
+	Delay     uint16
+	Error     string
+}
+
+// SourceCache keeps what a parser source returned last time.
+type SourceCache struct {
+	Name         string `gorm:"primarykey"`
+	UpdatedAt    time.Time
+	ETag         string
+	LastModified string
+	ContentHash  string
+}
+
+// Source is the statistics of a parser source in a fetch run.
+type Source struct {
+	ID             uint `gorm:"primarykey"`
+	CreatedAt      time.Time
+	RunID          string `gorm:"index"`
+	Name           string `gorm:"index"`
+	Seen           int
+	ParseFailed    int
+	ValidateFailed int
+	Duplicated     int
+	Created        int
+	NotModified    bool
+	Error          string
+	Duration       time.Duration
+	// Unreachable is the part of ValidateFailed which failed the pre-check
+	Unreachable int
+	// Unsupported is the number of proxies which can not be validated, they are stored unvalidated
+	Unsupported int
+	// Reachable is the number of proxies which passed the pre-check
+	Reachable int
+}
+
 type Result struct {
 	Proxy *Proxy
 	Error error
 }
 
 type Handler struct {
-	db *gorm.DB
+	cfg *config.StorageConfig
+	db  *gorm.DB
 }
 
-func Init(cfg *config.StorageConfig) (*Handler, error) {
-	var (
-		db  *gorm.DB
-		err error
-	)
-	newLogger := logger.New(
+func newLogger() logger.Interface {
+	return logger.New(
 		log.New(os.Stdout, "\r\n", log.LstdFlags), // io writer
 		logger.Config{
 			SlowThreshold:             time.Second,   // Slow SQL threshold
@@ -66,6 +134,13 @@ func Init(cfg *config.StorageConfig) (*Handler, error) {
 			Colorful:                  false,         // Disable color
 		},
 	)
+}
+
+func Init(cfg *config.StorageConfig) (*Handler, error) {
+	var (
+		db  *gorm.DB
+		err error
+	)
 	switch cfg.Driver {
 	case "sqlite":
 		if _, err := os.Stat(cfg.DSN); os.IsNotExist(err) {
@@ -76,55 +151,299 @@ func Init(cfg *config.StorageConfig) (*Handler, error) {
 			}
 			f.Close()
 		}
-		db, err = gorm.Open(sqlite.Open(cfg.DSN), &gorm.Config{Logger: newLogger})
+		db, err = gorm.Open(sqlite.Open(cfg.DSN), &gorm.Config{Logger: newLogger()})
 	}
 	if err != nil {
 		return nil, err
 	}
 
-	if err := db.AutoMigrate(&Proxy{}); err != nil {
+	if err := migrateFingerprint(db); err != nil {
+		return nil, fmt.Errorf("storage: migrate fingerprint error: %w", err)
+	}
+	backfill := !db.Migrator().HasTable(&ProxySource{})
+	if err := db.AutoMigrate(&Proxy{}, &SourceCache{}, &Source{}, &ProxySource{}, &Check{}, &ProfileResult{}); err != nil {
 		return nil, fmt.Errorf("storage: db.AutoMigrate error: %w", err)
 	}
+	if backfill {
+		// the proxies saved before have the first source only
+		if err := db.Exec(`INSERT INTO proxy_sources (proxy_id, source, first_seen_at, last_seen_at)
+			SELECT id, source, created_at, updated_at FROM proxies WHERE source != ''`).Error; err != nil {
+			return nil, fmt.Errorf("storage: backfill proxy sources error: %w", err)
+		}
+	}
+
+	return &Handler{
+		cfg: cfg,
+		db:  db,
+	}, nil
+}
+
+// Open opens the existing database read-only, nothing is created or migrated,
+// the error is os.ErrNotExist if the database has not been created.
+func Open(cfg *config.StorageConfig) (*Handler, error) {
+	var (
+		db  *gorm.DB
+		err error
+	)
+	switch cfg.Driver {
+	case "sqlite":
+		if _, err := os.Stat(cfg.DSN); err != nil {
+			return nil, err
+		}
+		db, err = gorm.Open(sqlite.Open("file:"+cfg.DSN+"?mode=ro"), &gorm.Config{Logger: newLogger()})
+	}
+	if err != nil {
+		return nil, err
+	}
 
 	return &Handler{
-		db: db,
+		cfg: cfg,
+		db:  db,
 	}, nil
 }
 
+// Close closes the database.
+func (h *Handler) Close() error {
+	db, err := h.db.DB()
+	if err != nil {
+		return err
+	}
+	return db.Close()
+}
+
+// migrateFingerprint fills the fingerprints of the proxies saved before and removes the duplicated ones,
+// the proxies were unique by server and port, the old unique index is dropped.
+func migrateFingerprint(db *gorm.DB) error {
+	m := db.Migrator()
+	if !m.HasTable(&Proxy{}) || m.HasColumn(&Proxy{}, "Fingerprint") {
+		return nil
+	}
+
+	if m.HasIndex(&Proxy{}, "idx_server_port") {
+		if err := m.DropIndex(&Proxy{}, "idx_server_port"); err != nil {
+			return err
+		}
+	}
+	if err := m.AddColumn(&Proxy{}, "Fingerprint"); err != nil {
+		return err
+	}
+
+	ps := []*Proxy{}
+	if err := db.Find(&ps).Error; err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	for _, p := range ps {
+		pp, err := p.Restore(p.Config)
+		if err != nil {
+			continue
+		}
+		fp, err := proxy.Fingerprint(pp)
+		if err != nil {
+			continue
+		}
+		if seen[fp] {
+			if err := db.Delete(&Proxy{}, p.ID).Error; err != nil {
+				return err
+			}
+			continue
+		}
+		seen[fp] = true
+		if err := db.Model(&Proxy{}).Where("id = ?", p.ID).Update("fingerprint", fp).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (h *Handler) Remove(ctx context.Context, id uint) error {
-	return h.db.Delete(&Proxy{}, id).Error
+	return h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("proxy_id = ?", id).Delete(&ProxySource{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("proxy_id = ?", id).Delete(&Check{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("proxy_id = ?", id).Delete(&ProfileResult{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Proxy{}, id).Error
+	})
 }
 
 func (h *Handler) Update(ctx context.Context, p *Proxy) error {
 	b := p.GetBase()
-	return h.db.Model(p).Updates(map[string]interface{}{"delay": b.Delay, "country_code": b.CountryCode, "country": b.Country}).Error
+	return h.db.Model(p).Updates(map[string]interface{}{
+		"delay":             b.Delay,
+		"country_code":      b.CountryCode,
+		"country":           b.Country,
+		"entry_ip":          p.EntryIP,
+		"exit_ip":           p.ExitIP,
+		"exit_country":      p.ExitCountry,
+		"exit_country_code": p.ExitCountryCode,
+		"exit_checked_at":   p.ExitCheckedAt,
+		"speed":             p.Speed,
+		"udp_ok":            p.UDPOK,
+	}).Error
 }
 
+// Create saves the proxy, it returns false if the proxy with the same fingerprint is known.
+// The proxy with the same transport but other credentials is the known node whose credentials are rotated,
+// it is updated in place and keeps its ID, checks and sources, false is returned too.
 func (h *Handler) Create(ctx context.Context, p proxy.Proxy) (*Proxy, bool, error) {
-	m, err := p.ConfigMap()
+	pp, err := NewProxy(p)
+	if err != nil {
+		return nil, false, err
+	}
+	pp.Fingerprint, err = proxy.Fingerprint(p)
 	if err != nil {
 		return nil, false, err
 	}
 
-	data, err := json.Marshal(m)
+	created := false
+	pp.ID, err = h.proxyID(ctx, "fingerprint = ?", pp.Fingerprint)
 	if err != nil {
 		return nil, false, err
 	}
+	if pp.ID == 0 {
+		if pp.ID, err = h.rotatedProxyID(ctx, p); err != nil {
+			return nil, false, err
+		}
+		if pp.ID != 0 {
+			if err := h.db.Model(&Proxy{}).Where("id = ?", pp.ID).Updates(map[string]interface{}{
+				"config":      pp.Config,
+				"link":        pp.Link,
+				"fingerprint": pp.Fingerprint,
+			}).Error; err != nil {
+				return nil, false, err
+			}
+		}
+	}
+	if pp.ID == 0 {
+		r := h.db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "fingerprint"}},
+			DoNothing: true,
+		}).Create(pp)
+		if r.Error != nil {
+			return nil, false, r.Error
+		}
+		created = r.RowsAffected > 0
+		if !created {
+			if pp.ID, err = h.proxyID(ctx, "fingerprint = ?", pp.Fingerprint); err != nil {
+				return nil, false, err
+			}
+		}
+	}
 
-	pp := &Proxy{
-		Base:   p.GetBase(),
-		Config: string(data),
+	if source := p.GetBase().Source; source != "" && pp.ID != 0 {
+		if err := h.saveProxySource(ctx, pp.ID, source); err != nil {
+			return pp, created, err
+		}
+	}
+
+	return pp, created, nil
+}
+
+// rotatedProxyID returns the ID of the proxy with the same transport as p but other credentials, 0 if none.
+func (h *Handler) rotatedProxyID(ctx context.Context, p proxy.Proxy) (uint, error) {
+	transport, err := proxy.Transport(p)
+	if err != nil {
+		return 0, err
+	}
+
+	b := p.GetBase()
+	ps := []*Proxy{}
+	if err := h.db.Where("type = ? AND server = ? AND port = ?", b.Type, b.Server, b.Port).Order("id").Find(&ps).Error; err != nil {
+		return 0, err
+	}
+	for _, c := range ps {
+		cp, err := c.Restore(c.Config)
+		if err != nil {
+			continue
+		}
+		if t, err := proxy.Transport(cp); err == nil && t == transport {
+			return c.ID, nil
+		}
+	}
+	return 0, nil
+}
+
+// proxyID returns 0 if no proxy matches.
+func (h *Handler) proxyID(ctx context.Context, query string, args ...interface{}) (uint, error) {
+	ids := []uint{}
+	if err := h.db.Model(&Proxy{}).Where(query, args...).Limit(1).Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
 	}
+	return ids[0], nil
+}
+
+func (h *Handler) saveProxySource(ctx context.Context, proxyID uint, source string) error {
+	now := time.Now()
+	return h.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "proxy_id"}, {Name: "source"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"last_seen_at": now}),
+	}).Create(&ProxySource{
+		ProxyID:     proxyID,
+		Source:      source,
+		FirstSeenAt: now,
+		LastSeenAt:  now,
+	}).Error
+}
+
+// maxQueryIDs is the maximum number of ids in a query, sqlite limits the number of variables.
+const maxQueryIDs = 500
 
-	r := h.db.Clauses(clause.OnConflict{
-		Columns:   []clause.Column{{Name: "server"}, {Name: "port"}},
-		DoNothing: true,
-	}).Create(pp)
+// GetProxySources returns the sources of the proxies.
+func (h *Handler) GetProxySources(ctx context.Context, ids []uint) (map[uint][]*ProxySource, error) {
+	m := map[uint][]*ProxySource{}
+	if err := batchIDs(ids, func(ids []uint) error {
+		pss := []*ProxySource{}
+		if err := h.db.Where("proxy_id IN (?)", ids).Order("first_seen_at").Find(&pss).Error; err != nil {
+			return err
+		}
+		for _, ps := range pss {
+			m[ps.ProxyID] = append(m[ps.ProxyID], ps)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// batchIDs calls f with the ids in batches of maxQueryIDs.
+func batchIDs(ids []uint, f func(ids []uint) error) error {
+	for len(ids) > 0 {
+		n := len(ids)
+		if n > maxQueryIDs {
+			n = maxQueryIDs
+		}
+		if err := f(ids[:n]); err != nil {
+			return err
+		}
+		ids = ids[n:]
+	}
+	return nil
+}
+
+// GetSourceCache returns nil if the source has no cache.
+func (h *Handler) GetSourceCache(ctx context.Context, name string) (*SourceCache, error) {
+	sc := &SourceCache{}
+	r := h.db.Where("name = ?", name).Limit(1).Find(sc)
 	if r.Error != nil {
-		return nil, false, r.Error
+		return nil, r.Error
+	}
+	if r.RowsAffected == 0 {
+		return nil, nil
 	}
+	return sc, nil
+}
 
-	return pp, r.RowsAffected > 0, nil
+func (h *Handler) SaveSourceCache(ctx context.Context, sc *SourceCache) error {
+	return h.db.Save(sc).Error
 }
 
 type QueryOptions struct {
@@ -132,31 +451,158 @@ type QueryOptions struct {
 	CountryCodes    string
 	NotCountryCodes string
 	Count           int
-	Fast            bool
+	// Fast is the same as sorting by delay
+	Fast bool
+	// Sort is one of SortDelay, SortReliability and SortSpeed, random if empty
+	Sort string
+	// Healthy excludes the unhealthy proxies
+	Healthy bool
+	// ExitCountry filters the country codes by the exit countries, the unknown exits are excluded then
+	ExitCountry bool
+	// Profile filters the proxies which pass the validation profile
+	Profile string
+	// MinSpeed filters the proxies by the download speed in kbps
+	MinSpeed uint
+	// Types filters the proxies by the types, all types if empty
+	Types []proxy.Type
 }
 
+const (
+	SortDelay       = "delay"
+	SortReliability = "reliability"
+	SortSpeed       = "speed"
+)
+
 func (h *Handler) GetProxies(ctx context.Context, opts *QueryOptions) ([]*Proxy, error) {
 	ps := []*Proxy{}
 	db := h.db
 	if opts != nil && opts.ID != 0 {
 		db = db.Where("id = ?", opts.ID)
 	}
+	countryColumn := "country_code"
+	if opts != nil && opts.ExitCountry {
+		countryColumn = "exit_country_code"
+		// the unknown exits may be in any country, they match neither the country codes nor the not country codes
+		if opts.CountryCodes != "" || opts.NotCountryCodes != "" {
+			db = db.Where("exit_country_code != ''")
+		}
+	}
 	if opts != nil && opts.CountryCodes != "" {
-		db = db.Where("country_code IN (?)", strings.Split(opts.CountryCodes, ","))
+		db = db.Where(countryColumn+" IN (?)", strings.Split(opts.CountryCodes, ","))
 	}
 	if opts != nil && opts.NotCountryCodes != "" {
-		db = db.Where("country_code NOT IN (?)", strings.Split(opts.NotCountryCodes, ","))
+		db = db.Where(countryColumn+" NOT IN (?)", strings.Split(opts.NotCountryCodes, ","))
+	}
+
+	if opts != nil && opts.Profile != "" {
+		db = db.Where("id IN (?)", h.db.Model(&ProfileResult{}).Select("proxy_id").Where("profile = ? AND success = ?", opts.Profile, true))
+	}
+	if opts != nil && opts.MinSpeed > 0 {
+		db = db.Where("speed >= ?", opts.MinSpeed)
+	}
+	if opts != nil && opts.Healthy {
+		db = db.Where("unhealthy = ?", false)
+	}
+	if opts != nil && len(opts.Types) > 0 {
+		db = db.Where("type IN (?)", opts.Types)
 	}
 
 	if opts != nil && opts.Count > 0 {
 		db = db.Limit(opts.Count)
 	}
 
-	if opts != nil && opts.Fast {
-		db = db.Order("delay")
-	} else {
+	sortBy := ""
+	if opts != nil {
+		sortBy = opts.Sort
+		if opts.Fast && sortBy == "" {
+			sortBy = SortDelay
+		}
+	}
+	switch sortBy {
+	case SortDelay:
+		// the unvalidated proxies have no delay, they come last
+		db = db.Order("delay = 0").Order("delay")
+	case SortReliability:
+		db = db.Order("success_rate DESC").Order("median_delay").Order("jitter")
+	case SortSpeed:
+		db = db.Order("speed DESC")
+	case "":
 		db = db.Order("RANDOM()")
+	default:
+		return nil, fmt.Errorf("storage: invalid sort: %s", sortBy)
 	}
 
 	return ps, db.Find(&ps).Error
 }
+
+func (h *Handler) CreateSource(ctx context.Context, s *Source) error {
+	return h.db.Create(s).Error
+}
+
+type SourceQueryOptions struct {
+	Name string
+	// Runs limits the result to the latest N runs of every source
+	Runs int
+}
+
+// GetSources returns the source records, the latest first.
+func (h *Handler) GetSources(ctx context.Context, opts *SourceQueryOptions) ([]*Source, error) {
+	ss := []*Source{}
+	// the database opened read-only may be created before the sources are recorded
+	if !h.db.Migrator().HasTable(&Source{}) {
+		return ss, nil
+	}
+	db := h.db.Order("created_at DESC, id DESC")
+	if opts != nil && opts.Name != "" {
+		db = db.Where("name = ?", opts.Name)
+	}
+	if err := db.Find(&ss).Error; err != nil {
+		return nil, err
+	}
+
+	if opts == nil || opts.Runs <= 0 {
+		return ss, nil
+	}
+	result := []*Source{}
+	counts := map[string]int{}
+	for _, s := range ss {
+		if counts[s.Name] < opts.Runs {
+			counts[s.Name]++
+			result = append(result, s)
+		}
+	}
+	return result, nil
+}
+
+func (h *Handler) SaveProfileResult(ctx context.Context, r *ProfileResult) error {
+	return h.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "proxy_id"}, {Name: "profile"}},
+		DoUpdates: clause.AssignmentColumns([]string{"updated_at", "success", "delay", "error"}),
+	}).Create(r).Error
+}
+
+// GetProfileResults returns the profile results of the proxies.
+func (h *Handler) GetProfileResults(ctx context.Context, ids []uint) (map[uint][]*ProfileResult, error) {
+	m := map[uint][]*ProfileResult{}
+	if err := batchIDs(ids, func(ids []uint) error {
+		rs := []*ProfileResult{}
+		if err := h.db.Where("proxy_id IN (?)", ids).Order("profile").Find(&rs).Error; err != nil {
+			return err
+		}
+		for _, r := range rs {
+			m[r.ProxyID] = append(m[r.ProxyID], r)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// PruneProfileResults removes the results of the profiles which are not in the names.
+func (h *Handler) PruneProfileResults(ctx context.Context, names []string) error {
+	if len(names) == 0 {
+		return h.db.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&ProfileResult{}).Error
+	}
+	return h.db.Where("profile NOT IN (?)", names).Delete(&ProfileResult{}).Error
+}
@@ -0,0 +1,254 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xwjdsh/freeproxy/config"
+	"github.com/xwjdsh/freeproxy/proxy"
+)
+
+func newTestHandler(t *testing.T, dsn string) *Handler {
+	h, err := Init(&config.StorageConfig{Driver: "sqlite", DSN: dsn, CheckWindow: 10})
+	require.Nil(t, err)
+	t.Cleanup(func() {
+		if db, err := h.db.DB(); err == nil {
+			db.Close()
+		}
+	})
+	return h
+}
+
+func newTestProxy(t *testing.T, source string, m map[string]interface{}) proxy.Proxy {
+	p, err := proxy.NewProxyByConfigMap(m)
+	require.Nil(t, err)
+	p.GetBase().Source = source
+	return p
+}
+
+func ssConfig(server, password string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":     "ss",
+		"server":   server,
+		"port":     8388,
+		"cipher":   "aes-128-gcm",
+		"password": password,
+	}
+}
+
+func TestCreateProxySources(t *testing.T) {
+	ctx := context.Background()
+	h := newTestHandler(t, filepath.Join(t.TempDir(), "db"))
+
+	a, created, err := h.Create(ctx, newTestProxy(t, "a", trojanConfig("1.1.1.1", "x")))
+	require.Nil(t, err)
+	assert.True(t, created)
+	b, created, err := h.Create(ctx, newTestProxy(t, "b", trojanConfig("2.2.2.2", "x")))
+	require.Nil(t, err)
+	assert.True(t, created)
+
+	// seen again in the same source and in a new one
+	for _, source := range []string{"a", "c"} {
+		p, created, err := h.Create(ctx, newTestProxy(t, source, trojanConfig("1.1.1.1", "x")))
+		require.Nil(t, err)
+		assert.False(t, created)
+		assert.Equal(t, a.ID, p.ID)
+	}
+
+	m, err := h.GetProxySources(ctx, []uint{a.ID})
+	require.Nil(t, err)
+	require.Len(t, m, 1)
+	require.Len(t, m[a.ID], 2)
+	assert.Equal(t, "a", m[a.ID][0].Source)
+	assert.Equal(t, "c", m[a.ID][1].Source)
+	assert.True(t, m[a.ID][0].LastSeenAt.After(m[a.ID][0].FirstSeenAt))
+
+	m, err = h.GetProxySources(ctx, []uint{a.ID, b.ID})
+	require.Nil(t, err)
+	assert.Len(t, m, 2)
+	assert.Equal(t, "b", m[b.ID][0].Source)
+
+	m, err = h.GetProxySources(ctx, nil)
+	require.Nil(t, err)
+	assert.Empty(t, m)
+}
+
+func TestBackfillProxySources(t *testing.T) {
+	ctx := context.Background()
+	dsn := filepath.Join(t.TempDir(), "db")
+	h := newTestHandler(t, dsn)
+
+	p, _, err := h.Create(ctx, newTestProxy(t, "a", trojanConfig("1.1.1.1", "x")))
+	require.Nil(t, err)
+	// the database before the proxy sources are recorded
+	require.Nil(t, h.db.Migrator().DropTable(&ProxySource{}))
+
+	h = newTestHandler(t, dsn)
+	m, err := h.GetProxySources(ctx, []uint{p.ID})
+	require.Nil(t, err)
+	require.Len(t, m[p.ID], 1)
+	assert.Equal(t, "a", m[p.ID][0].Source)
+
+	// the backfill runs once
+	require.Nil(t, h.db.Where("proxy_id = ?", p.ID).Delete(&ProxySource{}).Error)
+	h = newTestHandler(t, dsn)
+	m, err = h.GetProxySources(ctx, []uint{p.ID})
+	require.Nil(t, err)
+	assert.Empty(t, m)
+}
+
+func TestOpen(t *testing.T) {
+	ctx := context.Background()
+	dsn := filepath.Join(t.TempDir(), "db")
+	cfg := &config.StorageConfig{Driver: "sqlite", DSN: dsn}
+
+	_, err := Open(cfg)
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+
+	h := newTestHandler(t, dsn)
+	require.Nil(t, h.CreateSource(ctx, &Source{Name: "a", Created: 1}))
+
+	h, err = Open(cfg)
+	require.Nil(t, err)
+	defer h.Close()
+	ss, err := h.GetSources(ctx, nil)
+	require.Nil(t, err)
+	require.Len(t, ss, 1)
+	// nothing is written
+	assert.NotNil(t, h.CreateSource(ctx, &Source{Name: "b"}))
+}
+
+func trojanConfig(server, password string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":     "trojan",
+		"server":   server,
+		"port":     443,
+		"password": password,
+	}
+}
+
+func TestCreateProxy(t *testing.T) {
+	ctx := context.Background()
+	h := newTestHandler(t, filepath.Join(t.TempDir(), "db"))
+
+	p, created, err := h.Create(ctx, newTestProxy(t, "a", trojanConfig("1.1.1.1", "x")))
+	require.Nil(t, err)
+	assert.True(t, created)
+	assert.NotZero(t, p.ID)
+	assert.NotEmpty(t, p.Fingerprint)
+
+	// the same node with another name and client options is a duplicate
+	m := trojanConfig("1.1.1.1", "x")
+	m["name"], m["udp"], m["alpn"], m["sni"] = "b", true, []string{"h2"}, "example.com"
+	dup, created, err := h.Create(ctx, newTestProxy(t, "b", m))
+	require.Nil(t, err)
+	assert.False(t, created)
+	assert.Equal(t, p.ID, dup.ID)
+
+	// the credentials rotated on the same server update the proxy in place
+	_, err = h.RecordCheck(ctx, &Check{ProxyID: p.ID, Delay: 100, Success: true})
+	require.Nil(t, err)
+	rotated, created, err := h.Create(ctx, newTestProxy(t, "c", trojanConfig("1.1.1.1", "y")))
+	require.Nil(t, err)
+	assert.False(t, created)
+	assert.Equal(t, p.ID, rotated.ID)
+	assert.NotEqual(t, p.Fingerprint, rotated.Fingerprint)
+
+	got := &Proxy{}
+	require.Nil(t, h.db.First(got, p.ID).Error)
+	assert.Equal(t, rotated.Fingerprint, got.Fingerprint)
+	assert.Contains(t, got.Config, `"password":"y"`)
+	var count int64
+	require.Nil(t, h.db.Model(&Check{}).Where("proxy_id = ?", p.ID).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+	sources, err := h.GetProxySources(ctx, []uint{p.ID})
+	require.Nil(t, err)
+	assert.Len(t, sources[p.ID], 3)
+
+	// another transport on the same server is a separate proxy
+	m = trojanConfig("1.1.1.1", "y")
+	m["network"], m["ws-opts"] = "ws", map[string]interface{}{"path": "/ws"}
+	other, created, err := h.Create(ctx, newTestProxy(t, "a", m))
+	require.Nil(t, err)
+	assert.True(t, created)
+	assert.NotEqual(t, p.ID, other.ID)
+
+	require.Nil(t, h.db.Model(&Proxy{}).Count(&count).Error)
+	assert.Equal(t, int64(2), count)
+
+	p = rotated
+	p.Delay, p.CountryCode, p.Speed = 100, "US", 2048
+	require.Nil(t, h.Update(ctx, p))
+	got = &Proxy{}
+	require.Nil(t, h.db.First(got, p.ID).Error)
+	assert.Equal(t, uint16(100), got.Delay)
+	assert.Equal(t, "US", got.CountryCode)
+	assert.Equal(t, uint(2048), got.Speed)
+	assert.Equal(t, p.Fingerprint, got.Fingerprint)
+	assert.Contains(t, got.Config, `"password":"y"`)
+}
+
+func TestGetProxiesByExitCountry(t *testing.T) {
+	ctx := context.Background()
+	h := newTestHandler(t, filepath.Join(t.TempDir(), "db"))
+
+	ids := map[string]uint{}
+	for server, code := range map[string]string{"1.1.1.1": "US", "2.2.2.2": "JP", "3.3.3.3": ""} {
+		p, _, err := h.Create(ctx, newTestProxy(t, "a", ssConfig(server, "x")))
+		require.Nil(t, err)
+		p.CountryCode, p.ExitCountryCode = "US", code
+		require.Nil(t, h.Update(ctx, p))
+		ids[code] = p.ID
+	}
+	query := func(opts *QueryOptions) []uint {
+		ps, err := h.GetProxies(ctx, opts)
+		require.Nil(t, err)
+		got := []uint{}
+		for _, p := range ps {
+			got = append(got, p.ID)
+		}
+		return got
+	}
+
+	assert.ElementsMatch(t, []uint{ids["US"]}, query(&QueryOptions{ExitCountry: true, CountryCodes: "US"}))
+	// the unknown exit is not known to be outside US
+	assert.ElementsMatch(t, []uint{ids["JP"]}, query(&QueryOptions{ExitCountry: true, NotCountryCodes: "US"}))
+	assert.Len(t, query(&QueryOptions{ExitCountry: true}), 3)
+	assert.Len(t, query(&QueryOptions{CountryCodes: "US"}), 3)
+}
+
+func TestProfileResults(t *testing.T) {
+	ctx := context.Background()
+	h := newTestHandler(t, filepath.Join(t.TempDir(), "db"))
+
+	p, _, err := h.Create(ctx, newTestProxy(t, "a", ssConfig("1.1.1.1", "x")))
+	require.Nil(t, err)
+	for _, profile := range []string{"b", "a", "removed"} {
+		require.Nil(t, h.SaveProfileResult(ctx, &ProfileResult{ProxyID: p.ID, Profile: profile, Success: true}))
+	}
+	// the result is updated in place
+	require.Nil(t, h.SaveProfileResult(ctx, &ProfileResult{ProxyID: p.ID, Profile: "a", Error: "timeout"}))
+
+	require.Nil(t, h.PruneProfileResults(ctx, []string{"a", "b"}))
+	m, err := h.GetProfileResults(ctx, []uint{p.ID})
+	require.Nil(t, err)
+	require.Len(t, m[p.ID], 2)
+	assert.Equal(t, "a", m[p.ID][0].Profile)
+	assert.False(t, m[p.ID][0].Success)
+	assert.Equal(t, "b", m[p.ID][1].Profile)
+
+	m, err = h.GetProfileResults(ctx, nil)
+	require.Nil(t, err)
+	assert.Empty(t, m)
+
+	require.Nil(t, h.PruneProfileResults(ctx, nil))
+	m, err = h.GetProfileResults(ctx, []uint{p.ID})
+	require.Nil(t, err)
+	assert.Empty(t, m)
+}
@@ -0,0 +1,72 @@
+package freeproxy
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/xwjdsh/freeproxy/config"
+	"github.com/xwjdsh/freeproxy/storage"
+)
+
+// checkWindow returns the number of latest checks the tidy policy needs.
+func checkWindow(cfg *config.AppTidyConfig) int {
+	if cfg.FailureWindow > cfg.MaxConsecutiveFailures {
+		return cfg.FailureWindow
+	}
+	return cfg.MaxConsecutiveFailures
+}
+
+// lastOKAt returns the time of the latest successful check, nil if there is none.
+func lastOKAt(p *storage.Proxy, checks []*storage.Check) *time.Time {
+	if p.LastOKAt != nil {
+		return p.LastOKAt
+	}
+	for _, c := range checks {
+		if c.Success {
+			return &c.CreatedAt
+		}
+	}
+	return nil
+}
+
+// evictReason returns why the proxy should be removed, empty if it should be kept.
+// The checks are the latest first, including the current one.
+func evictReason(cfg *config.AppTidyConfig, p *storage.Proxy, checks []*storage.Check, now time.Time) string {
+	if len(checks) == 0 || checks[0].Success {
+		return ""
+	}
+
+	if n := cfg.MaxConsecutiveFailures; n > 0 {
+		failures := 0
+		for _, c := range checks {
+			if c.Success {
+				break
+			}
+			failures++
+		}
+		if failures >= n {
+			return fmt.Sprintf("%d consecutive failures", failures)
+		}
+	}
+
+	if cfg.MaxFailureRatio > 0 && cfg.FailureWindow > 0 && len(checks) >= cfg.FailureWindow {
+		failures := 0
+		for _, c := range checks[:cfg.FailureWindow] {
+			if !c.Success {
+				failures++
+			}
+		}
+		if ratio := float64(failures) / float64(cfg.FailureWindow); ratio >= cfg.MaxFailureRatio {
+			return fmt.Sprintf("failure ratio %.2f in %d checks", ratio, cfg.FailureWindow)
+		}
+	}
+
+	// the proxies saved before the checks were recorded have no success history, the rule is skipped for them
+	if lastOK := lastOKAt(p, checks); cfg.MaxSuccessAge > 0 && lastOK != nil {
+		if age := now.Sub(*lastOK); age > cfg.MaxSuccessAge {
+			return fmt.Sprintf("no success in %s", age.Round(time.Hour))
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,53 @@
+package freeproxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/xwjdsh/freeproxy/config"
+	"github.com/xwjdsh/freeproxy/storage"
+)
+
+func TestEvictReason(t *testing.T) {
+	now := time.Now()
+	cfg := &config.AppTidyConfig{
+		MaxConsecutiveFailures: 3,
+		MaxFailureRatio:        0.5,
+		FailureWindow:          4,
+		MaxSuccessAge:          24 * time.Hour,
+	}
+	// checks builds the checks from the results, the latest first, an hour apart
+	checks := func(results ...bool) []*storage.Check {
+		cs := []*storage.Check{}
+		for i, ok := range results {
+			cs = append(cs, &storage.Check{CreatedAt: now.Add(-time.Duration(i) * time.Hour), Success: ok})
+		}
+		return cs
+	}
+	ago := func(d time.Duration) *time.Time {
+		t := now.Add(-d)
+		return &t
+	}
+	old := &storage.Proxy{CreatedAt: now.Add(-30 * 24 * time.Hour)}
+
+	for _, c := range []struct {
+		name   string
+		proxy  *storage.Proxy
+		checks []*storage.Check
+		reason string
+	}{
+		{"no checks", old, nil, ""},
+		{"latest success", &storage.Proxy{LastOKAt: ago(0)}, checks(true, false, false, false), ""},
+		{"consecutive failures", &storage.Proxy{LastOKAt: ago(3 * time.Hour)}, checks(false, false, false, true), "3 consecutive failures"},
+		{"failure ratio", &storage.Proxy{LastOKAt: ago(time.Hour)}, checks(false, true, false, true), "failure ratio 0.50 in 4 checks"},
+		{"ratio below the window", &storage.Proxy{LastOKAt: ago(time.Hour)}, checks(false, true, false), ""},
+		{"success age", &storage.Proxy{LastOKAt: ago(48 * time.Hour)}, checks(false, true), "no success in 48h0m0s"},
+		{"success age from checks", old, checks(false, true), ""},
+		// the proxies saved before the checks were recorded are not evicted by age
+		{"no success history", old, checks(false), ""},
+	} {
+		assert.Equal(t, c.reason, evictReason(cfg, c.proxy, c.checks, now), c.name)
+	}
+}
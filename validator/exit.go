@@ -0,0 +1,107 @@
+package validator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/xwjdsh/freeproxy/proxy"
+)
+
+// resolveIP returns the first IP of the host, the host is returned if it is an IP already.
+func resolveIP(ctx context.Context, host string) (net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip, nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("validator: no address of host: %s", host)
+	}
+	return addrs[0].IP, nil
+}
+
+// EntryIP returns the IP of the proxy server.
+func (v *Validator) EntryIP(ctx context.Context, server string) (string, error) {
+	ip, err := resolveIP(ctx, server)
+	if err != nil {
+		return "", err
+	}
+	return ip.String(), nil
+}
+
+// ExitIP requests the IP echo URL through the proxy and returns the IP the proxy connects out from,
+// an empty IP is returned if the URL is not set.
+func (v *Validator) ExitIP(ctx context.Context, p proxy.Proxy) (string, error) {
+	if v.cfg.ExitIPURL == "" {
+		return "", nil
+	}
+
+	dial, err := v.Dialer(p)
+	if err != nil {
+		return "", err
+	}
+	client := &http.Client{
+		Transport: &http.Transport{DialContext: dial, DisableKeepAlives: true},
+		Timeout:   v.cfg.ExitIPTimeout,
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.cfg.ExitIPURL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("validator: ExitIP unexpected status code: %d", resp.StatusCode)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return "", err
+	}
+	return parseEchoIP(data)
+}
+
+// ExitIPStale reports whether the exit IP looked up at checkedAt should be looked up again,
+// it is always false if the IP echo URL is not set.
+func (v *Validator) ExitIPStale(checkedAt *time.Time) bool {
+	if v.cfg.ExitIPURL == "" {
+		return false
+	}
+	return checkedAt == nil || time.Since(*checkedAt) >= v.cfg.ExitIPTTL
+}
+
+// parseEchoIP accepts a plain IP, or a JSON object with the IP in one of the common fields.
+func parseEchoIP(data []byte) (string, error) {
+	s := strings.TrimSpace(string(data))
+	if ip := net.ParseIP(s); ip != nil {
+		return ip.String(), nil
+	}
+
+	m := map[string]interface{}{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return "", fmt.Errorf("validator: invalid IP echo response: %s", s)
+	}
+	for _, k := range []string{"ip", "query", "origin", "address"} {
+		v, _ := m[k].(string)
+		// httpbin returns the IPs of all hops in origin
+		v = strings.TrimSpace(strings.Split(v, ",")[0])
+		if ip := net.ParseIP(v); ip != nil {
+			return ip.String(), nil
+		}
+	}
+	return "", fmt.Errorf("validator: invalid IP echo response: %s", s)
+}
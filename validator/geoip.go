@@ -0,0 +1,126 @@
+package validator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+var ErrCountryNotFound = errors.New("validator: country not found")
+
+// GeoIP looks up the country of a host.
+type GeoIP interface {
+	Country(ctx context.Context, host string) (code string, name string, err error)
+}
+
+// mmdbGeoIP looks up the countries in a MaxMind mmdb database, the domains are resolved first.
+type mmdbGeoIP struct {
+	reader *geoip2.Reader
+}
+
+func newMMDBGeoIP(path string) (*mmdbGeoIP, error) {
+	reader, err := geoip2.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("validator: open geoip database error: %w", err)
+	}
+	return &mmdbGeoIP{reader: reader}, nil
+}
+
+func (g *mmdbGeoIP) Country(ctx context.Context, host string) (string, string, error) {
+	ip, err := resolveIP(ctx, host)
+	if err != nil {
+		return "", "", err
+	}
+
+	c, err := g.reader.Country(ip)
+	if err != nil {
+		return "", "", err
+	}
+	if c.Country.IsoCode == "" {
+		return "", "", ErrCountryNotFound
+	}
+	return c.Country.IsoCode, c.Country.Names["en"], nil
+}
+
+// httpGeoIP looks up the countries by ip-api.com, it is rate limited.
+type httpGeoIP struct{}
+
+func (g *httpGeoIP) Country(ctx context.Context, host string) (string, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://ip-api.com/json/%s?fields=countryCode,country", host), nil)
+	if err != nil {
+		return "", "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return "", "", fmt.Errorf("validator: GetCountryInfo unexpected status code: %d", resp.StatusCode)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", "", err
+	}
+
+	var res struct {
+		Country     string `json:"country"`
+		CountryCode string `json:"countryCode"`
+	}
+	if err := json.Unmarshal(data, &res); err != nil {
+		return "", "", err
+	}
+	if res.CountryCode == "" {
+		return "", "", ErrCountryNotFound
+	}
+
+	return res.CountryCode, res.Country, nil
+}
+
+// chainGeoIP tries the providers in order until one succeeds.
+type chainGeoIP []GeoIP
+
+func (g chainGeoIP) Country(ctx context.Context, host string) (string, string, error) {
+	err := ErrCountryNotFound
+	for _, p := range g {
+		var code, name string
+		code, name, err = p.Country(ctx, host)
+		if err == nil {
+			return code, name, nil
+		}
+	}
+	return "", "", err
+}
+
+// cachedGeoIP caches the successful lookups.
+type cachedGeoIP struct {
+	GeoIP
+	cache sync.Map
+}
+
+type countryInfo struct {
+	code string
+	name string
+}
+
+func (g *cachedGeoIP) Country(ctx context.Context, host string) (string, string, error) {
+	if v, ok := g.cache.Load(host); ok {
+		c := v.(*countryInfo)
+		return c.code, c.name, nil
+	}
+
+	code, name, err := g.GeoIP.Country(ctx, host)
+	if err != nil {
+		return "", "", err
+	}
+	g.cache.Store(host, &countryInfo{code: code, name: name})
+	return code, name, nil
+}
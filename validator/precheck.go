@@ -0,0 +1,74 @@
+package validator
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/xwjdsh/freeproxy/proxy"
+)
+
+// PreCheckEnabled reports whether the pre-check is configured.
+func (v *Validator) PreCheckEnabled() bool {
+	cfg := v.cfg.PreCheck
+	return cfg != nil && cfg.Enable
+}
+
+// PreCheckWorker returns the worker count of the pre-check stage.
+func (v *Validator) PreCheckWorker() int {
+	if w := v.cfg.PreCheck.Worker; w > 0 {
+		return w
+	}
+	return 1
+}
+
+// PreCheck connects to the proxy server, and does the TLS handshake if configured, it is much cheaper than
+// the validation.
+func (v *Validator) PreCheck(ctx context.Context, p proxy.Proxy) error {
+	base := p.GetBase()
+	if !Supported(base.Type) {
+		return fmt.Errorf("validator: %w: %s", proxy.ErrUnsupportedType, base.Type)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, v.cfg.PreCheck.Timeout)
+	defer cancel()
+
+	address := net.JoinHostPort(base.Server, strconv.Itoa(base.Port))
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if !v.cfg.PreCheck.TLS {
+		return nil
+	}
+	serverName, ok := tlsServerName(p)
+	if !ok {
+		return nil
+	}
+	// only the reachability is checked, the certificate is verified by the validation
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: serverName, InsecureSkipVerify: true})
+	return tlsConn.HandshakeContext(ctx)
+}
+
+// tlsServerName returns the server name if the proxy is over TLS.
+func tlsServerName(p proxy.Proxy) (string, bool) {
+	m, err := p.ConfigMap()
+	if err != nil {
+		return "", false
+	}
+
+	base := p.GetBase()
+	if tlsEnabled, _ := m["tls"].(bool); !tlsEnabled && base.Type != proxy.Trojan {
+		return "", false
+	}
+	for _, k := range []string{"sni", "servername"} {
+		if v, _ := m[k].(string); v != "" {
+			return v, true
+		}
+	}
+	return base.Server, true
+}
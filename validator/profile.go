@@ -0,0 +1,197 @@
+package validator
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xwjdsh/freeproxy/config"
+	"github.com/xwjdsh/freeproxy/proxy"
+)
+
+const (
+	AggregationMin = "min"
+	AggregationAvg = "avg"
+	AggregationP95 = "p95"
+)
+
+// maxProfileBodySize limits the body read to match the expected body.
+const maxProfileBodySize = 1 << 20
+
+type ProfileResult struct {
+	Profile string
+	Success bool
+	// Delay is the aggregated delay of the successful requests in milliseconds
+	Delay uint16
+	Error error
+}
+
+// newProfiles checks the configured profiles and returns the copies with the defaults filled.
+func newProfiles(cfg *config.ValidatorConfig) ([]*config.ValidatorProfile, error) {
+	profiles := make([]*config.ValidatorProfile, 0, len(cfg.Profiles))
+	names := map[string]bool{}
+	for _, cp := range cfg.Profiles {
+		p := *cp
+		if p.Name == "" || names[p.Name] {
+			return nil, fmt.Errorf("validator: empty or duplicated profile name: %q", p.Name)
+		}
+		names[p.Name] = true
+
+		if len(p.Targets) == 0 {
+			return nil, fmt.Errorf("validator: profile %s has no targets", p.Name)
+		}
+		switch p.Aggregation {
+		case "":
+			p.Aggregation = AggregationAvg
+		case AggregationMin, AggregationAvg, AggregationP95:
+		default:
+			return nil, fmt.Errorf("validator: profile %s has invalid aggregation: %s", p.Name, p.Aggregation)
+		}
+		if p.Count <= 0 {
+			p.Count = 1
+		}
+		if p.Timeout <= 0 {
+			p.Timeout = cfg.TestURLTimeout
+		}
+		profiles = append(profiles, &p)
+	}
+	return profiles, nil
+}
+
+// Profiles returns the validation profiles with the defaults filled.
+func (v *Validator) Profiles() []*config.ValidatorProfile {
+	return v.profiles
+}
+
+// ValidateProfiles validates the proxy with all the profiles concurrently,
+// the profiles not done in ProfilesTimeout fail with the deadline error.
+func (v *Validator) ValidateProfiles(ctx context.Context, p proxy.Proxy) []*ProfileResult {
+	if v.cfg.ProfilesTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, v.cfg.ProfilesTimeout)
+		defer cancel()
+	}
+
+	rs := make([]*ProfileResult, len(v.profiles))
+	wg := sync.WaitGroup{}
+	wg.Add(len(v.profiles))
+	for i, profile := range v.profiles {
+		go func(i int, profile *config.ValidatorProfile) {
+			defer wg.Done()
+			rs[i] = v.ValidateProfile(ctx, p, profile)
+		}(i, profile)
+	}
+	wg.Wait()
+	return rs
+}
+
+// ValidateProfile requests the targets of the profile through the proxy, the profile passes if every target
+// has a successful request.
+func (v *Validator) ValidateProfile(ctx context.Context, p proxy.Proxy, profile *config.ValidatorProfile) *ProfileResult {
+	r := &ProfileResult{Profile: profile.Name}
+	dial, err := v.Dialer(p)
+	if err != nil {
+		r.Error = err
+		return r
+	}
+	client := &http.Client{
+		Transport: &http.Transport{DialContext: dial, DisableKeepAlives: true},
+		Timeout:   profile.Timeout,
+	}
+
+	delays := []float64{}
+	for _, t := range profile.Targets {
+		ok := false
+		for i := 0; i < profile.Count; i++ {
+			delay, err := requestTarget(ctx, client, t)
+			if err != nil {
+				r.Error = err
+				continue
+			}
+			ok = true
+			delays = append(delays, float64(delay.Milliseconds()))
+		}
+		if !ok {
+			return r
+		}
+	}
+
+	r.Success = true
+	r.Error = nil
+	r.Delay = aggregate(delays, profile.Aggregation)
+	return r
+}
+
+func requestTarget(ctx context.Context, client *http.Client, t *config.ValidatorTarget) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.URL, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	delay := time.Since(start)
+
+	if !statusExpected(resp.StatusCode, t.ExpectedStatus) {
+		return 0, fmt.Errorf("validator: %s unexpected status code: %d", t.URL, resp.StatusCode)
+	}
+	if t.ExpectedBody == "" {
+		return delay, nil
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxProfileBodySize))
+	if err != nil {
+		return 0, err
+	}
+	if !strings.Contains(string(data), t.ExpectedBody) {
+		return 0, fmt.Errorf("validator: %s unexpected body", t.URL)
+	}
+	return delay, nil
+}
+
+func statusExpected(code int, expected []int) bool {
+	if len(expected) == 0 {
+		return code < 400
+	}
+	for _, c := range expected {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+func aggregate(delays []float64, aggregation string) uint16 {
+	if len(delays) == 0 {
+		return 0
+	}
+
+	sort.Float64s(delays)
+	var d float64
+	switch aggregation {
+	case AggregationMin:
+		d = delays[0]
+	case AggregationP95:
+		d = delays[int(math.Ceil(0.95*float64(len(delays))))-1]
+	default:
+		for _, v := range delays {
+			d += v
+		}
+		d /= float64(len(delays))
+	}
+	if d > math.MaxUint16 {
+		return math.MaxUint16
+	}
+	return uint16(d)
+}
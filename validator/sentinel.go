@@ -0,0 +1,158 @@
+package validator
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/xwjdsh/freeproxy/config"
+	"github.com/xwjdsh/freeproxy/log"
+)
+
+var ErrNetworkDown = errors.New("validator: local network is down")
+
+// Sentinel checks the local network periodically, the validations are paused when the network is down
+// or the failure ratio spikes. Every outage starts a new epoch, the failures of the validations which
+// cross epochs are not trusted.
+type Sentinel struct {
+	v   *Validator
+	cfg *config.AppTidySentinelConfig
+
+	mutex    sync.Mutex
+	paused   bool
+	pausedAt time.Time
+	outage   bool
+	epoch    int
+	resumed  chan struct{}
+	results  []bool
+	checkNow chan struct{}
+}
+
+func (v *Validator) NewSentinel(cfg *config.AppTidySentinelConfig) *Sentinel {
+	return &Sentinel{
+		v:        v,
+		cfg:      cfg,
+		resumed:  make(chan struct{}),
+		checkNow: make(chan struct{}, 1),
+	}
+}
+
+// Run checks the network until ctx is done.
+func (s *Sentinel) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.checkNow:
+		}
+
+		err := func() error {
+			ctx, cancel := context.WithTimeout(ctx, s.cfg.Timeout)
+			defer cancel()
+			return s.v.CheckNetwork(ctx)
+		}()
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.L().Warn("validator: sentinel network check failed", zap.Error(err))
+			s.setOutage()
+		} else {
+			s.resume()
+		}
+	}
+}
+
+// Report records a validation result, the validations are paused if the failure ratio spikes.
+func (s *Sentinel) Report(success bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.results = append(s.results, success)
+	if len(s.results) > s.cfg.SpikeWindow {
+		s.results = s.results[len(s.results)-s.cfg.SpikeWindow:]
+	}
+	if len(s.results) < s.cfg.SpikeWindow || s.paused {
+		return
+	}
+
+	failures := 0
+	for _, ok := range s.results {
+		if !ok {
+			failures++
+		}
+	}
+	if float64(failures)/float64(len(s.results)) >= s.cfg.SpikeRatio {
+		log.L().Warn("validator: failure ratio spiked, checking network", zap.Int("failures", failures))
+		s.pause()
+		select {
+		case s.checkNow <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Wait blocks while the validations are paused and returns the current epoch,
+// ErrNetworkDown is returned if the pause exceeds the max pause.
+func (s *Sentinel) Wait(ctx context.Context) (int, error) {
+	for {
+		s.mutex.Lock()
+		if !s.paused {
+			epoch := s.epoch
+			s.mutex.Unlock()
+			return epoch, nil
+		}
+		resumed := s.resumed
+		remaining := s.cfg.MaxPause - time.Since(s.pausedAt)
+		s.mutex.Unlock()
+
+		if remaining <= 0 {
+			return 0, ErrNetworkDown
+		}
+		select {
+		case <-resumed:
+		case <-time.After(remaining):
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+}
+
+// pause must be called with the lock held.
+func (s *Sentinel) pause() {
+	if !s.paused {
+		s.paused = true
+		s.pausedAt = time.Now()
+		s.resumed = make(chan struct{})
+	}
+}
+
+func (s *Sentinel) setOutage() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.pause()
+	if !s.outage {
+		s.outage = true
+		s.epoch++
+	}
+}
+
+func (s *Sentinel) resume() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.paused {
+		s.paused = false
+		s.outage = false
+		s.results = nil
+		close(s.resumed)
+	}
+}
@@ -0,0 +1,93 @@
+package validator
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/xwjdsh/freeproxy/config"
+	"github.com/xwjdsh/freeproxy/proxy"
+)
+
+// ThroughputEnabled reports whether the throughput test is configured.
+func (v *Validator) ThroughputEnabled() bool {
+	cfg := v.cfg.Throughput
+	return cfg != nil && cfg.Enable && cfg.URL != ""
+}
+
+// Throughput downloads the payload through the proxy and returns the speed in kbps,
+// the download is bounded by the configured duration and size.
+func (v *Validator) Throughput(ctx context.Context, p proxy.Proxy) (uint, error) {
+	dial, err := v.Dialer(p)
+	if err != nil {
+		return 0, err
+	}
+	return throughput(ctx, dial, v.cfg.Throughput)
+}
+
+func throughput(ctx context.Context, dial func(ctx context.Context, network, address string) (net.Conn, error), cfg *config.ValidatorThroughputConfig) (uint, error) {
+	client := &http.Client{
+		Transport: &http.Transport{DialContext: dial, DisableKeepAlives: true},
+	}
+
+	// only the local deadline ends the download as a measurement, the parent cancellation is an error
+	parent := ctx
+	ctx, cancel := context.WithTimeout(ctx, cfg.Duration)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cfg.URL, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return 0, fmt.Errorf("validator: Throughput unexpected status code: %d", resp.StatusCode)
+	}
+
+	// the clock starts at the first chunk, which is not counted, so the delay is not part of the speed
+	var body io.Reader = resp.Body
+	if cfg.MaxBytes > 0 {
+		body = io.LimitReader(resp.Body, cfg.MaxBytes)
+	}
+	buf := make([]byte, 32*1024)
+	var (
+		n     int64
+		start time.Time
+	)
+	for {
+		m, err := body.Read(buf)
+		if m > 0 {
+			if start.IsZero() {
+				start = time.Now()
+			} else {
+				n += int64(m)
+			}
+		}
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			if parent.Err() != nil {
+				return 0, parent.Err()
+			}
+			if ctx.Err() != nil {
+				break
+			}
+			return 0, err
+		}
+	}
+
+	elapsed := time.Since(start).Seconds()
+	if start.IsZero() || n == 0 || elapsed <= 0 {
+		return 0, fmt.Errorf("validator: Throughput not enough data received")
+	}
+	return uint(float64(n) * 8 / 1000 / elapsed), nil
+}
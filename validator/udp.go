@@ -0,0 +1,156 @@
+package validator
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	C "github.com/Dreamacro/clash/constant"
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/xwjdsh/freeproxy/proxy"
+)
+
+// maxDNSMessageSize is the max size of a DNS message over UDP.
+const maxDNSMessageSize = 65535
+
+// UDPEnabled reports whether the UDP check is configured.
+func (v *Validator) UDPEnabled() bool {
+	cfg := v.cfg.UDP
+	return cfg != nil && cfg.Enable && cfg.Resolver != ""
+}
+
+// CheckUDP sends DNS queries to the resolver through the UDP relay of the proxy,
+// it returns nil if a valid answer is received in any of the attempts.
+func (v *Validator) CheckUDP(ctx context.Context, p proxy.Proxy) error {
+	cfg := v.cfg.UDP
+	// the stored udp field is what the source claims, the relay is tried anyway
+	clashProxy, err := parseClashProxy(p, func(m map[string]interface{}) {
+		m["udp"] = true
+	})
+	if err != nil {
+		return err
+	}
+
+	addr, err := net.ResolveUDPAddr("udp", cfg.Resolver)
+	if err != nil {
+		return fmt.Errorf("validator: invalid UDP resolver: %w", err)
+	}
+	metadata := &C.Metadata{
+		NetWork:  C.UDP,
+		DstIP:    addr.IP,
+		DstPort:  fmt.Sprint(addr.Port),
+		AddrType: C.AtypIPv4,
+	}
+	if addr.IP.To4() == nil {
+		metadata.AddrType = C.AtypIPv6
+	}
+
+	attempts := cfg.Attempts
+	if attempts <= 0 {
+		attempts = 1
+	}
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout*time.Duration(attempts))
+	defer cancel()
+
+	pc, err := clashProxy.ListenPacketContext(ctx, metadata)
+	if err != nil {
+		return err
+	}
+	defer pc.Close()
+
+	// the packet conn does not watch the context
+	go func() {
+		<-ctx.Done()
+		pc.SetDeadline(time.Now())
+	}()
+	return exchangeDNS(ctx, pc, addr, cfg.Domain, attempts, cfg.Timeout)
+}
+
+// exchangeDNS sends a new query in every attempt and waits for its answer until the timeout,
+// the UDP packets may be lost, so only the failures of all the attempts fail the check.
+func exchangeDNS(ctx context.Context, pc net.PacketConn, addr net.Addr, domain string, attempts int, timeout time.Duration) error {
+	buf := make([]byte, maxDNSMessageSize)
+	for i := 0; i < attempts; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		data, id, err := dnsQuery(domain)
+		if err != nil {
+			return err
+		}
+		deadline := time.Now().Add(timeout)
+		if err := pc.SetDeadline(deadline); err != nil {
+			return err
+		}
+		if _, err := pc.WriteTo(data, addr); err != nil {
+			return err
+		}
+
+		for {
+			n, _, err := pc.ReadFrom(buf)
+			if err != nil {
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() && !time.Now().Before(deadline) {
+					break
+				}
+				return err
+			}
+			header, ok := dnsAnswer(buf[:n], id)
+			if !ok {
+				// not the answer of the query, e.g. a late answer of the last attempt
+				continue
+			}
+			if header.RCode != dnsmessage.RCodeSuccess {
+				return fmt.Errorf("validator: DNS answer with rcode: %s", header.RCode)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("validator: no valid DNS answer in %d attempts", attempts)
+}
+
+// dnsAnswer parses the header of the message, it reports whether the message answers the query of the id.
+func dnsAnswer(msg []byte, id uint16) (dnsmessage.Header, bool) {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(msg)
+	if err != nil || !header.Response || header.ID != id {
+		return header, false
+	}
+	return header, true
+}
+
+// dnsQuery builds a recursive DNS query of the A record of the domain with a random id.
+func dnsQuery(domain string) ([]byte, uint16, error) {
+	name, err := dnsmessage.NewName(fqdn(domain))
+	if err != nil {
+		return nil, 0, fmt.Errorf("validator: invalid UDP domain: %w", err)
+	}
+
+	var rb [2]byte
+	if _, err := rand.Read(rb[:]); err != nil {
+		return nil, 0, err
+	}
+	id := binary.BigEndian.Uint16(rb[:])
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, RecursionDesired: true})
+	if err := b.StartQuestions(); err != nil {
+		return nil, 0, err
+	}
+	if err := b.Question(dnsmessage.Question{Name: name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET}); err != nil {
+		return nil, 0, err
+	}
+	data, err := b.Finish()
+	return data, id, err
+}
+
+func fqdn(domain string) string {
+	if strings.HasSuffix(domain, ".") {
+		return domain
+	}
+	return domain + "."
+}
@@ -2,26 +2,51 @@ package validator
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"strings"
+	"syscall"
 
 	"github.com/Dreamacro/clash/adapter"
+	C "github.com/Dreamacro/clash/constant"
 
 	"github.com/xwjdsh/freeproxy/config"
 	"github.com/xwjdsh/freeproxy/proxy"
 )
 
 type Validator struct {
-	cfg *config.ValidatorConfig
+	cfg      *config.ValidatorConfig
+	geoIP    GeoIP
+	profiles []*config.ValidatorProfile
 }
 
-func New(cfg *config.ValidatorConfig) *Validator {
-	return &Validator{
-		cfg: cfg,
+func New(cfg *config.ValidatorConfig) (*Validator, error) {
+	profiles, err := newProfiles(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	providers := chainGeoIP{}
+	if cfg.GeoIPDatabasePath != "" {
+		g, err := newMMDBGeoIP(cfg.GeoIPDatabasePath)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, g)
 	}
+	if cfg.GeoIPHTTPFallback || len(providers) == 0 {
+		providers = append(providers, &httpGeoIP{})
+	}
+
+	return &Validator{
+		cfg:      cfg,
+		geoIP:    &cachedGeoIP{GeoIP: providers},
+		profiles: profiles,
+	}, nil
 }
 
 func (v *Validator) CheckNetwork(ctx context.Context) error {
@@ -39,12 +64,37 @@ func (v *Validator) CheckNetwork(ctx context.Context) error {
 	return nil
 }
 
-func (v *Validator) Validate(ctx context.Context, p proxy.Proxy) error {
+// SupportedTypes are the proxy types the pinned clash adapter supports,
+// the proxies of the other types are stored unvalidated.
+var SupportedTypes = []proxy.Type{proxy.SS, proxy.SSR, proxy.Vmess, proxy.Trojan}
+
+// Supported reports whether the proxies of the type can be validated.
+func Supported(t proxy.Type) bool {
+	for _, st := range SupportedTypes {
+		if st == t {
+			return true
+		}
+	}
+	return false
+}
+
+// parseClashProxy creates the clash adapter of the proxy, the config map can be changed by modify.
+func parseClashProxy(p proxy.Proxy, modify func(m map[string]interface{})) (C.Proxy, error) {
+	if t := p.GetBase().Type; !Supported(t) {
+		return nil, fmt.Errorf("validator: %w: %s", proxy.ErrUnsupportedType, t)
+	}
 	m, err := p.ConfigMap()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if modify != nil {
+		modify(m)
 	}
-	clashProxy, err := adapter.ParseProxy(m)
+	return adapter.ParseProxy(m)
+}
+
+func (v *Validator) Validate(ctx context.Context, p proxy.Proxy) error {
+	clashProxy, err := parseClashProxy(p, nil)
 	if err != nil {
 		return err
 	}
@@ -70,38 +120,86 @@ func (v *Validator) Validate(ctx context.Context, p proxy.Proxy) error {
 	return nil
 }
 
-func (v *Validator) GetCountryInfo(ctx context.Context, server string) (string, string, error) {
-	ctx, cancel := context.WithTimeout(ctx, v.cfg.GetCountryInfoTimeout)
-	defer cancel()
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://ip-api.com/json/%s?fields=countryCode,country", server), nil)
-	if err != nil {
-		return "", "", err
-	}
-	resp, err := http.DefaultClient.Do(req)
+// Dialer returns a dial function which connects to the address through the proxy.
+func (v *Validator) Dialer(p proxy.Proxy) (func(ctx context.Context, network, address string) (net.Conn, error), error) {
+	clashProxy, err := parseClashProxy(p, nil)
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		return "", "", fmt.Errorf("validator: GetCountryInfo unexpected status code: %d", resp.StatusCode)
-	}
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		if network != "tcp" && network != "tcp4" && network != "tcp6" {
+			return nil, fmt.Errorf("validator: unsupported network: %s", network)
+		}
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
 
-	data, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return "", "", err
-	}
+		metadata := &C.Metadata{
+			NetWork:  C.TCP,
+			Host:     host,
+			DstPort:  port,
+			AddrType: C.AtypDomainName,
+		}
+		if ip := net.ParseIP(host); ip != nil {
+			metadata.Host = ""
+			metadata.DstIP = ip
+			metadata.AddrType = C.AtypIPv4
+			if ip.To4() == nil {
+				metadata.AddrType = C.AtypIPv6
+			}
+		}
+
+		return clashProxy.DialContext(ctx, metadata)
+	}, nil
+}
 
-	var res struct {
-		Country     string `json:"country"`
-		CountryCode string `json:"countryCode"`
+const (
+	ErrorClassTimeout = "timeout"
+	ErrorClassRefused = "refused"
+	ErrorClassReset   = "reset"
+	ErrorClassEOF     = "eof"
+	ErrorClassDNS     = "dns"
+	ErrorClassTLS     = "tls"
+	ErrorClassOther   = "other"
+)
+
+// ErrorClass classifies the validation error, the errors from the proxy adapters are not always wrapped,
+// so the message is checked as well.
+func ErrorClass(err error) string {
+	if err == nil {
+		return ""
 	}
-	if err := json.Unmarshal(data, &res); err != nil {
-		return "", "", err
+
+	var (
+		netErr net.Error
+		dnsErr *net.DNSError
+		msg    = strings.ToLower(err.Error())
+	)
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout(), strings.Contains(msg, "timeout"):
+		return ErrorClassTimeout
+	case errors.As(err, &dnsErr), strings.Contains(msg, "no such host"):
+		return ErrorClassDNS
+	case errors.Is(err, syscall.ECONNREFUSED), strings.Contains(msg, "connection refused"):
+		return ErrorClassRefused
+	case errors.Is(err, syscall.ECONNRESET), strings.Contains(msg, "connection reset"):
+		return ErrorClassReset
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF), strings.HasSuffix(msg, "eof"):
+		return ErrorClassEOF
+	case strings.Contains(msg, "tls"), strings.Contains(msg, "x509"), strings.Contains(msg, "certificate"):
+		return ErrorClassTLS
+	default:
+		return ErrorClassOther
 	}
+}
+
+func (v *Validator) GetCountryInfo(ctx context.Context, server string) (string, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, v.cfg.GetCountryInfoTimeout)
+	defer cancel()
 
-	return res.CountryCode, res.Country, nil
+	return v.geoIP.Country(ctx, server)
 }
 
 func (c *Validator) GetTestURL() string {
@@ -3,12 +3,26 @@ package validator
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/Dreamacro/clash/adapter"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/xwjdsh/freeproxy/config"
+	"github.com/xwjdsh/freeproxy/proxy"
 )
 
 func TestUrlTest(t *testing.T) {
@@ -28,3 +42,420 @@ func TestUrlTest(t *testing.T) {
 
 	fmt.Println(delay)
 }
+
+func TestSentinel(t *testing.T) {
+	var down int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&down) == 1 {
+			panic(http.ErrAbortHandler)
+		}
+	}))
+	defer s.Close()
+
+	v, err := New(&config.ValidatorConfig{TestNetworkURL: s.URL})
+	require.Nil(t, err)
+	sentinel := v.NewSentinel(&config.AppTidySentinelConfig{
+		Interval:    time.Hour,
+		Timeout:     time.Second,
+		SpikeWindow: 2,
+		SpikeRatio:  1,
+		MaxPause:    200 * time.Millisecond,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go sentinel.Run(ctx)
+
+	epoch, err := sentinel.Wait(ctx)
+	require.Nil(t, err)
+
+	// the spike is caused by the proxies, the network is fine
+	sentinel.Report(false)
+	sentinel.Report(false)
+	current, err := sentinel.Wait(ctx)
+	require.Nil(t, err)
+	assert.Equal(t, epoch, current)
+
+	atomic.StoreInt32(&down, 1)
+	sentinel.Report(false)
+	sentinel.Report(false)
+	_, err = sentinel.Wait(ctx)
+	assert.Equal(t, ErrNetworkDown, err)
+}
+
+type fakeGeoIP map[string]string
+
+func (g fakeGeoIP) Country(ctx context.Context, host string) (string, string, error) {
+	if code, ok := g[host]; ok {
+		return code, code, nil
+	}
+	return "", "", ErrCountryNotFound
+}
+
+func TestGeoIPChain(t *testing.T) {
+	lookups := fakeGeoIP{"1.1.1.1": "US"}
+	g := &cachedGeoIP{GeoIP: chainGeoIP{fakeGeoIP{"8.8.8.8": "DE"}, lookups}}
+
+	code, _, err := g.Country(context.Background(), "8.8.8.8")
+	require.Nil(t, err)
+	assert.Equal(t, "DE", code)
+
+	code, _, err = g.Country(context.Background(), "1.1.1.1")
+	require.Nil(t, err)
+	assert.Equal(t, "US", code)
+
+	delete(lookups, "1.1.1.1")
+	code, _, err = g.Country(context.Background(), "1.1.1.1")
+	require.Nil(t, err)
+	assert.Equal(t, "US", code)
+
+	_, _, err = g.Country(context.Background(), "9.9.9.9")
+	assert.Equal(t, ErrCountryNotFound, err)
+
+	_, err = New(&config.ValidatorConfig{GeoIPDatabasePath: "not-exist.mmdb"})
+	assert.NotNil(t, err)
+}
+
+func TestParseEchoIP(t *testing.T) {
+	for body, ip := range map[string]string{
+		"1.2.3.4\n":                      "1.2.3.4",
+		`{"ip": "1.2.3.4"}`:              "1.2.3.4",
+		`{"query": "2001:db8::1"}`:       "2001:db8::1",
+		`{"origin": "1.2.3.4, 5.6.7.8"}`: "1.2.3.4",
+	} {
+		v, err := parseEchoIP([]byte(body))
+		require.Nil(t, err)
+		assert.Equal(t, ip, v)
+	}
+
+	_, err := parseEchoIP([]byte("<html></html>"))
+	assert.NotNil(t, err)
+}
+
+func TestExitIPStale(t *testing.T) {
+	v, err := New(&config.ValidatorConfig{})
+	require.Nil(t, err)
+	assert.False(t, v.ExitIPStale(nil))
+
+	v, err = New(&config.ValidatorConfig{ExitIPURL: "https://api.ipify.org", ExitIPTTL: time.Hour})
+	require.Nil(t, err)
+	recent, old := time.Now().Add(-time.Minute), time.Now().Add(-2*time.Hour)
+	assert.True(t, v.ExitIPStale(nil))
+	assert.False(t, v.ExitIPStale(&recent))
+	assert.True(t, v.ExitIPStale(&old))
+}
+
+func TestProfiles(t *testing.T) {
+	delays := []float64{300, 100, 200}
+	assert.Equal(t, uint16(100), aggregate(delays, AggregationMin))
+	assert.Equal(t, uint16(200), aggregate(delays, AggregationAvg))
+	assert.Equal(t, uint16(300), aggregate(delays, AggregationP95))
+
+	assert.True(t, statusExpected(204, nil))
+	assert.False(t, statusExpected(404, nil))
+	assert.True(t, statusExpected(404, []int{404}))
+
+	cfg := &config.ValidatorConfig{
+		TestURLTimeout: time.Second,
+		Profiles: []*config.ValidatorProfile{
+			{Name: "google", Targets: []*config.ValidatorTarget{{URL: "https://www.google.com"}}},
+		},
+	}
+	v, err := New(cfg)
+	require.Nil(t, err)
+	require.Len(t, v.Profiles(), 1)
+	assert.Equal(t, AggregationAvg, v.Profiles()[0].Aggregation)
+	assert.Equal(t, 1, v.Profiles()[0].Count)
+	assert.Equal(t, time.Second, v.Profiles()[0].Timeout)
+	// the config is not changed
+	assert.Equal(t, &config.ValidatorProfile{Name: "google", Targets: cfg.Profiles[0].Targets}, cfg.Profiles[0])
+
+	cfg.Profiles = append(cfg.Profiles, &config.ValidatorProfile{Name: "google", Targets: cfg.Profiles[0].Targets})
+	_, err = New(cfg)
+	assert.NotNil(t, err)
+}
+
+func TestValidateProfilesTimeout(t *testing.T) {
+	// the proxy server accepts the connections and never responds
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	addr := l.Addr().(*net.TCPAddr)
+	p, err := proxy.NewProxyByConfigMap(map[string]interface{}{
+		"type": "ss", "server": "127.0.0.1", "port": addr.Port, "cipher": "aes-256-gcm", "password": "password",
+	})
+	require.Nil(t, err)
+
+	targets := []*config.ValidatorTarget{{URL: "http://example.com"}}
+	v, err := New(&config.ValidatorConfig{
+		ProfilesTimeout: 200 * time.Millisecond,
+		Profiles: []*config.ValidatorProfile{
+			{Name: "a", Targets: targets, Timeout: time.Minute},
+			{Name: "b", Targets: targets, Timeout: time.Minute, Count: 3},
+		},
+	})
+	require.Nil(t, err)
+
+	start := time.Now()
+	rs := v.ValidateProfiles(context.Background(), p)
+	assert.Less(t, int64(time.Since(start)), int64(5*time.Second))
+	require.Len(t, rs, 2)
+	for i, name := range []string{"a", "b"} {
+		assert.Equal(t, name, rs[i].Profile)
+		assert.False(t, rs[i].Success)
+		assert.NotNil(t, rs[i].Error)
+	}
+}
+
+func TestThroughput(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f := w.(http.Flusher)
+		switch r.URL.Path {
+		case "/fixed":
+			// the first chunk is buffered before the clock starts, it is not counted
+			w.Header().Set("Content-Length", strconv.Itoa(4096+1000))
+			w.Write(make([]byte, 4096))
+			f.Flush()
+			time.Sleep(200 * time.Millisecond)
+			w.Write(make([]byte, 1000))
+		case "/endless":
+			for r.Context().Err() == nil {
+				w.Write(make([]byte, 1000))
+				f.Flush()
+				time.Sleep(10 * time.Millisecond)
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer s.Close()
+
+	dial := (&net.Dialer{}).DialContext
+	ctx := context.Background()
+	cfg := func(path string, d time.Duration) *config.ValidatorThroughputConfig {
+		return &config.ValidatorThroughputConfig{Enable: true, URL: s.URL + path, Duration: d}
+	}
+
+	// about 1000 bytes in 200ms, it is 200 kbps if the first chunk is counted
+	speed, err := throughput(ctx, dial, cfg("/fixed", 5*time.Second))
+	require.Nil(t, err)
+	assert.NotZero(t, speed)
+	assert.Less(t, speed, uint(100))
+
+	// the local deadline ends the measurement
+	speed, err = throughput(ctx, dial, cfg("/endless", 300*time.Millisecond))
+	require.Nil(t, err)
+	assert.NotZero(t, speed)
+
+	// the parent cancellation does not
+	cctx, cancel := context.WithTimeout(ctx, 300*time.Millisecond)
+	defer cancel()
+	_, err = throughput(cctx, dial, cfg("/endless", 5*time.Second))
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	_, err = throughput(ctx, dial, cfg("/404", 5*time.Second))
+	assert.NotNil(t, err)
+}
+
+func TestPreCheck(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	tlsServer := httptest.NewTLSServer(http.NotFoundHandler())
+	defer tlsServer.Close()
+
+	newProxy := func(typ string, addr string) proxy.Proxy {
+		host, port, err := net.SplitHostPort(addr)
+		require.Nil(t, err)
+		p, err := strconv.Atoi(port)
+		require.Nil(t, err)
+
+		m := map[string]interface{}{"name": "test", "server": host, "port": p, "password": "password"}
+		switch typ {
+		case "ss":
+			m["type"], m["cipher"] = "ss", "aes-256-gcm"
+		case "trojan":
+			m["type"], m["sni"] = "trojan", "example.com"
+		}
+		pp, err := proxy.NewProxyByConfigMap(m)
+		require.Nil(t, err)
+		return pp
+	}
+
+	cfg := &config.ValidatorConfig{
+		PreCheck: &config.ValidatorPreCheckConfig{Enable: true, Timeout: time.Second, TLS: true},
+	}
+	v, err := New(cfg)
+	require.Nil(t, err)
+
+	ctx := context.Background()
+	assert.Nil(t, v.PreCheck(ctx, newProxy("ss", l.Addr().String())))
+	assert.Nil(t, v.PreCheck(ctx, newProxy("trojan", tlsServer.Listener.Addr().String())))
+	// the server closes the connection before the TLS handshake
+	assert.NotNil(t, v.PreCheck(ctx, newProxy("trojan", l.Addr().String())))
+
+	l.Close()
+	assert.NotNil(t, v.PreCheck(ctx, newProxy("ss", l.Addr().String())))
+}
+
+func TestUnsupportedTypes(t *testing.T) {
+	p, err := proxy.NewProxyByLink(`vless://b831381d-6324-4d53-ad4f-8cda48b30811@1.2.3.4:443?security=tls&type=ws&host=cdn.example.com&path=%2Fws`)
+	require.Nil(t, err)
+	m, err := p.ConfigMap()
+	require.Nil(t, err)
+	// the pinned clash adapter can not create vless proxies, add the type to SupportedTypes after upgrading it
+	_, err = adapter.ParseProxy(m)
+	assert.NotNil(t, err)
+	assert.False(t, Supported(proxy.VLESS))
+
+	v, err := New(&config.ValidatorConfig{})
+	require.Nil(t, err)
+	err = v.Validate(context.Background(), p)
+	assert.True(t, errors.Is(err, proxy.ErrUnsupportedType))
+	_, err = v.Dialer(p)
+	assert.True(t, errors.Is(err, proxy.ErrUnsupportedType))
+
+	for _, link := range []string{
+		`hysteria://1.2.3.4:443?protocol=udp&auth=password&peer=example.com&upmbps=100&downmbps=100`,
+		`hysteria2://password@1.2.3.4:443?sni=example.com`,
+	} {
+		p, err := proxy.NewProxyByLink(link)
+		require.Nil(t, err)
+		m, err := p.ConfigMap()
+		require.Nil(t, err)
+		_, err = adapter.ParseProxy(m)
+		assert.NotNil(t, err)
+		assert.False(t, Supported(p.GetBase().Type))
+		// the UDP based proxies are not let through the pre-check to a validation which always fails
+		err = v.PreCheck(context.Background(), p)
+		assert.True(t, errors.Is(err, proxy.ErrUnsupportedType))
+	}
+
+	p, err = proxy.NewProxyByLink(`ss://YWVzLTI1Ni1nY206S2l4THZLendqZWtHMDBybQ@38.68.134.37:8080#test`)
+	require.Nil(t, err)
+	assert.True(t, Supported(p.GetBase().Type))
+	_, err = parseClashProxy(p, nil)
+	assert.Nil(t, err)
+}
+
+func TestErrorClass(t *testing.T) {
+	for _, c := range []struct {
+		err   error
+		class string
+	}{
+		{nil, ""},
+		{fmt.Errorf("validate: %w", context.DeadlineExceeded), ErrorClassTimeout},
+		{errors.New("dial tcp 1.2.3.4:443: i/o timeout"), ErrorClassTimeout},
+		{&net.DNSError{Err: "no such host", Name: "example.com"}, ErrorClassDNS},
+		{&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, ErrorClassRefused},
+		{errors.New("read: connection reset by peer"), ErrorClassReset},
+		{fmt.Errorf("read: %w", io.ErrUnexpectedEOF), ErrorClassEOF},
+		{errors.New("Get \"https://example.com\": EOF"), ErrorClassEOF},
+		{errors.New("x509: certificate signed by unknown authority"), ErrorClassTLS},
+		{errors.New("unexpected status code 403"), ErrorClassOther},
+	} {
+		assert.Equal(t, c.class, ErrorClass(c.err), fmt.Sprint(c.err))
+	}
+}
+
+func TestDNSQuery(t *testing.T) {
+	ids := map[uint16]bool{}
+	for i := 0; i < 20; i++ {
+		data, id, err := dnsQuery("example.com")
+		require.Nil(t, err)
+		ids[id] = true
+
+		var parser dnsmessage.Parser
+		header, err := parser.Start(data)
+		require.Nil(t, err)
+		assert.Equal(t, id, header.ID)
+		assert.True(t, header.RecursionDesired)
+		assert.False(t, header.Response)
+		q, err := parser.Question()
+		require.Nil(t, err)
+		assert.Equal(t, "example.com.", q.Name.String())
+		assert.Equal(t, dnsmessage.TypeA, q.Type)
+	}
+	// the ids are random
+	assert.Greater(t, len(ids), 1)
+
+	_, _, err := dnsQuery(strings.Repeat("a", 300))
+	assert.NotNil(t, err)
+}
+
+func TestExchangeDNS(t *testing.T) {
+	answer := func(id uint16, rcode dnsmessage.RCode) []byte {
+		b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, Response: true, RCode: rcode})
+		data, err := b.Finish()
+		require.Nil(t, err)
+		return data
+	}
+	// serve answers the queries by the handler, the queries are counted
+	serve := func(handle func(n int, id uint16) [][]byte) (net.Addr, *int32) {
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.Nil(t, err)
+		t.Cleanup(func() { pc.Close() })
+
+		var count int32
+		go func() {
+			buf := make([]byte, maxDNSMessageSize)
+			for {
+				n, addr, err := pc.ReadFrom(buf)
+				if err != nil {
+					return
+				}
+				var parser dnsmessage.Parser
+				header, err := parser.Start(buf[:n])
+				if err != nil {
+					continue
+				}
+				for _, msg := range handle(int(atomic.AddInt32(&count, 1)), header.ID) {
+					pc.WriteTo(msg, addr)
+				}
+			}
+		}()
+		return pc.LocalAddr(), &count
+	}
+	exchange := func(addr net.Addr, attempts int) error {
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.Nil(t, err)
+		defer pc.Close()
+		return exchangeDNS(context.Background(), pc, addr, "example.com", attempts, 200*time.Millisecond)
+	}
+
+	// the first query is lost, the answer of another query is ignored
+	addr, count := serve(func(n int, id uint16) [][]byte {
+		if n == 1 {
+			return nil
+		}
+		return [][]byte{answer(id+1, dnsmessage.RCodeSuccess), answer(id, dnsmessage.RCodeSuccess)}
+	})
+	assert.Nil(t, exchange(addr, 3))
+	assert.Equal(t, int32(2), atomic.LoadInt32(count))
+
+	addr, count = serve(func(n int, id uint16) [][]byte { return nil })
+	assert.NotNil(t, exchange(addr, 2))
+	assert.Equal(t, int32(2), atomic.LoadInt32(count))
+
+	addr, _ = serve(func(n int, id uint16) [][]byte {
+		return [][]byte{answer(id, dnsmessage.RCodeNameError)}
+	})
+	assert.NotNil(t, exchange(addr, 3))
+}